@@ -0,0 +1,281 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+)
+
+//Formats of AccessLog
+const (
+	//AccessLogCommon is the Common Log Format of the Apache HTTP Server:
+	//  192.0.2.10 - alice [10/Oct/2020:13:55:36 +0000] "GET /index.html HTTP/1.1" 200 2326
+	AccessLogCommon = "common"
+	//AccessLogCombined is the Combined Log Format of the Apache HTTP Server, which adds referer and user agent
+	//to the Common Log Format
+	AccessLogCombined = "combined"
+	//AccessLogJSON writes a JSON object per line with the fields of AccessLogRecord in snake case,
+	//the duration in milliseconds and empty fields omitted
+	AccessLogJSON = "json"
+)
+
+//AccessLogRecord describes a request and its response. User is the subject of the Principal set by a filter,
+//RequestID the ID assigned by RequestID.
+//If the request was rejected by a filter, Filter and Code are copied from the DeniedError. Its Reason is not logged,
+//as it may contain values of the request. Error contains any other error written with WriteError.
+type AccessLogRecord struct {
+	Time      time.Time
+	Method    string
+	URI       string
+	Proto     string
+	Status    int
+	Bytes     int64
+	Duration  time.Duration
+	IP        string
+	User      string
+	UserAgent string
+	Referer   string
+	RequestID string
+	Filter    string
+	Code      string
+	Error     string
+}
+
+//AccessLogParams configures AccessLog.
+//Format is AccessLogCommon, AccessLogCombined (the default), AccessLogJSON or a text/template that is executed
+//with an AccessLogRecord, e.g. "{{.Method}} {{.URI}} {{.Status}} {{.Duration}}". Its string fields are escaped like in
+//the Common Log Format.
+//Output defaults to os.Stdout. IPHeader has the same meaning as for IPFilter.
+//SampleRate is the fraction of successful requests that are logged, the default 1 logs all requests.
+//Requests that fail with a status of 400 or above are always logged.
+//Requests to paths that match one of the ExcludePaths are not logged, see PathGlob for the syntax of the patterns.
+type AccessLogParams struct {
+	Format       string
+	Output       io.Writer
+	IPHeader     string
+	SampleRate   float64
+	ExcludePaths []string
+}
+
+//accessLogEntry collects information from the following handlers, which they cannot pass back in the request context
+type accessLogEntry struct {
+	user      string
+	requestID string
+	err       error
+}
+
+//recordPrincipal notes the subject of the principal for the access log of the request
+func recordPrincipal(ctx context.Context, principal Principal) {
+	if entry, ok := ctx.Value(accessLogKey).(*accessLogEntry); ok {
+		entry.user = principal.Subject
+	}
+}
+
+//recordRequestID notes the ID assigned by RequestID for the access log of the request
+func recordRequestID(ctx context.Context, id string) {
+	if entry, ok := ctx.Value(accessLogKey).(*accessLogEntry); ok {
+		entry.requestID = id
+	}
+}
+
+//recordError notes the error for the access log of the request
+func recordError(ctx context.Context, err error) {
+	if entry, ok := ctx.Value(accessLogKey).(*accessLogEntry); ok {
+		entry.err = err
+	}
+}
+
+type accessLog struct {
+	next     http.Handler
+	params   AccessLogParams
+	format   func(*bytes.Buffer, AccessLogRecord)
+	excluded Predicate
+	output   *lockedWriter
+	now      func() time.Time
+}
+
+//lockedWriter serializes the lines written by all requests
+type lockedWriter struct {
+	sync.Mutex
+	w io.Writer
+}
+
+func (al accessLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if al.excluded(r) {
+		al.next.ServeHTTP(w, r)
+		return
+	}
+	start := al.now()
+	entry := &accessLogEntry{}
+	recorder := WrapResponseWriter(w)
+	ctx := context.WithValue(r.Context(), accessLogKey, entry)
+	al.next.ServeHTTP(recorder, r.WithContext(ctx))
+
+	status := recorder.Status()
+	if status == 0 {
+		status = 200
+	}
+	if status < 400 && al.params.SampleRate < 1 && rand.Float64() >= al.params.SampleRate {
+		return
+	}
+	ip, ok := clientIP(r, al.params.IPHeader)
+	if !ok {
+		ip = r.RemoteAddr
+	}
+	record := AccessLogRecord{
+		Time:      start,
+		Method:    r.Method,
+		URI:       r.RequestURI,
+		Proto:     r.Proto,
+		Status:    status,
+		Bytes:     recorder.BytesWritten(),
+		Duration:  al.now().Sub(start),
+		IP:        normalizeIP(ip),
+		User:      entry.user,
+		UserAgent: r.UserAgent(),
+		Referer:   r.Referer(),
+		RequestID: RequestIDFromContext(r.Context()),
+	}
+	if record.RequestID == "" {
+		record.RequestID = entry.requestID
+	}
+	if record.URI == "" {
+		record.URI = r.URL.RequestURI()
+	}
+	var denied *DeniedError
+	if errors.As(entry.err, &denied) {
+		record.Filter, record.Code = denied.Filter, denied.Code
+	} else if entry.err != nil {
+		record.Error = entry.err.Error()
+	}
+	var line bytes.Buffer
+	al.format(&line, record)
+	al.output.Lock()
+	defer al.output.Unlock()
+	al.output.w.Write(line.Bytes())
+}
+
+func formatCommonLog(line *bytes.Buffer, record AccessLogRecord) {
+	user := record.User
+	if user == "" {
+		user = "-"
+	}
+	size := "-"
+	if record.Bytes > 0 {
+		size = strconv.FormatInt(record.Bytes, 10)
+	}
+	fmt.Fprintf(line, "%s - %s [%s] \"%s %s %s\" %d %s", escapeLogValue(record.IP), escapeLogValue(user), record.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		escapeLogValue(record.Method), escapeLogValue(record.URI), escapeLogValue(record.Proto), record.Status, size)
+}
+
+func formatCombinedLog(line *bytes.Buffer, record AccessLogRecord) {
+	formatCommonLog(line, record)
+	referer, userAgent := record.Referer, record.UserAgent
+	if referer == "" {
+		referer = "-"
+	}
+	if userAgent == "" {
+		userAgent = "-"
+	}
+	fmt.Fprintf(line, " \"%s\" \"%s\"", escapeLogValue(referer), escapeLogValue(userAgent))
+}
+
+//escapeLogValue escapes quotes, backslashes and non-printable characters like the Apache HTTP Server
+func escapeLogValue(value string) string {
+	quoted := strconv.QuoteToASCII(value)
+	return quoted[1 : len(quoted)-1]
+}
+
+//escapeLogRecord escapes the fields of the record that contain values of the request for a template format
+func escapeLogRecord(record AccessLogRecord) AccessLogRecord {
+	for _, field := range []*string{&record.Method, &record.URI, &record.Proto, &record.IP, &record.User, &record.UserAgent,
+		&record.Referer, &record.RequestID, &record.Filter, &record.Code, &record.Error} {
+		*field = escapeLogValue(*field)
+	}
+	return record
+}
+
+func formatJSONLog(line *bytes.Buffer, record AccessLogRecord) {
+	json.NewEncoder(line).Encode(struct {
+		Time       time.Time `json:"time"`
+		Method     string    `json:"method"`
+		URI        string    `json:"uri"`
+		Proto      string    `json:"proto"`
+		Status     int       `json:"status"`
+		Bytes      int64     `json:"bytes"`
+		DurationMS float64   `json:"duration_ms"`
+		IP         string    `json:"ip"`
+		User       string    `json:"user,omitempty"`
+		UserAgent  string    `json:"user_agent,omitempty"`
+		Referer    string    `json:"referer,omitempty"`
+		RequestID  string    `json:"request_id,omitempty"`
+		Filter     string    `json:"filter,omitempty"`
+		Code       string    `json:"code,omitempty"`
+		Error      string    `json:"error,omitempty"`
+	}{record.Time, record.Method, record.URI, record.Proto, record.Status, record.Bytes, float64(record.Duration) / float64(time.Millisecond),
+		record.IP, record.User, record.UserAgent, record.Referer, record.RequestID, record.Filter, record.Code, record.Error})
+}
+
+//AccessLog writes a line for every request after it has been handled by the following handlers:
+//  accessLog := middleware.AccessLog(middleware.AccessLogParams{
+//  	Format:       middleware.AccessLogJSON,
+//  	ExcludePaths: []string{"/health", "/static/**"},
+//  })
+//  mux.Handle("/", middleware.Assemble(accessLog, recovery, hmac).ApplyToFunc(handler))
+//To record the denials of filters and the authenticated user, it has to be placed in front of the filters.
+//It panics if Format is neither one of the predefined formats nor a valid template.
+func AccessLog(params AccessLogParams) func(http.Handler) http.Handler {
+	al := accessLog{params: params, now: time.Now}
+	switch params.Format {
+	case AccessLogCommon:
+		al.format = func(line *bytes.Buffer, record AccessLogRecord) {
+			formatCommonLog(line, record)
+			line.WriteByte('\n')
+		}
+	case AccessLogCombined, "":
+		al.format = func(line *bytes.Buffer, record AccessLogRecord) {
+			formatCombinedLog(line, record)
+			line.WriteByte('\n')
+		}
+	case AccessLogJSON:
+		al.format = formatJSONLog
+	default:
+		tmpl, err := template.New("access log").Option("missingkey=error").Parse(params.Format)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to parse access log format: %s", err))
+		}
+		al.format = func(line *bytes.Buffer, record AccessLogRecord) {
+			if err := tmpl.Execute(line, escapeLogRecord(record)); err != nil {
+				fmt.Fprintf(line, "failed to format access log: %s", err)
+			}
+			line.WriteByte('\n')
+		}
+	}
+	if params.Output == nil {
+		params.Output = os.Stdout
+	}
+	if al.params.SampleRate <= 0 {
+		al.params.SampleRate = 1
+	}
+	al.output = &lockedWriter{w: params.Output}
+	al.excluded = func(r *http.Request) bool { return false }
+	if len(params.ExcludePaths) > 0 {
+		al.excluded = PathGlob(params.ExcludePaths...)
+	}
+	fn := func(next http.Handler) http.Handler {
+		al := al
+		al.next = next
+		return al
+	}
+	return fn
+}
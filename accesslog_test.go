@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	hmacFilter := HmacFilter(HmacParams{Provider: "github", Secret: "secret", KeyID: "github"})
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, "hello")
+	}
+	tests := []struct {
+		name    string
+		params  AccessLogParams
+		filter  func(http.Handler) http.Handler
+		request func() *http.Request
+		want    string
+	}{
+		{"common", AccessLogParams{Format: AccessLogCommon}, nil, func() *http.Request {
+			return httptest.NewRequest("GET", "/index.html?lang=en", nil)
+		}, `^192\.0\.2\.1 - - \[\d\d/\w\w\w/\d{4}:\d\d:\d\d:\d\d [+-]\d{4}\] "GET /index\.html\?lang=en HTTP/1\.1" 200 5\n$`},
+		{"combined", AccessLogParams{}, nil, func() *http.Request {
+			r := httptest.NewRequest("GET", "/missing", nil)
+			r.Header.Set("User-Agent", `curl/8.0 "quoted"`)
+			return r
+		}, `^192\.0\.2\.1 - - \[.+\] "GET /missing HTTP/1\.1" 404 19 "-" "curl/8\.0 \\"quoted\\""\n$`},
+		{"ip header", AccessLogParams{Format: "{{.IP}}", IPHeader: "X-Forwarded-For"}, nil, func() *http.Request {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("X-Forwarded-For", "198.51.100.7")
+			return r
+		}, `^198\.51\.100\.7\n$`},
+		{"ip header is escaped", AccessLogParams{IPHeader: "X-Forwarded-For"}, nil, func() *http.Request {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("X-Forwarded-For", "198.51.100.7\n203.0.113.1")
+			return r
+		}, `^198\.51\.100\.7\\n203\.0\.113\.1 - - \[`},
+		{"template", AccessLogParams{Format: "{{.Method}} {{.URI}} {{.Status}} {{.Bytes}} {{.RequestID}}"}, RequestID(RequestIDParams{}), func() *http.Request {
+			r := httptest.NewRequest("POST", "/hooks", nil)
+			r.Header.Set("X-Request-ID", "abc")
+			return r
+		}, `^POST /hooks 200 5 abc\n$`},
+		{"user of principal", AccessLogParams{Format: "{{.User}} {{.Status}}"}, hmacFilter, func() *http.Request {
+			r := httptest.NewRequest("POST", "/hooks", strings.NewReader("payload"))
+			mac := hmac.New(sha1.New, []byte("secret"))
+			mac.Write([]byte("payload"))
+			r.Header.Set("X-Hub-Signature", "sha1="+hex.EncodeToString(mac.Sum(nil)))
+			return r
+		}, `^github 200\n$`},
+		{"denial", AccessLogParams{Format: "{{.Status}} {{.Filter}}: {{.Code}}"}, hmacFilter, func() *http.Request {
+			return httptest.NewRequest("POST", "/hooks", nil)
+		}, `^403 hmac: invalid_signature\n$`},
+		{"template is escaped", AccessLogParams{Format: "{{.Method}} {{.UserAgent}}"}, nil, func() *http.Request {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("User-Agent", "curl\n127.0.0.1 - admin")
+			return r
+		}, `^GET curl\\n127\.0\.0\.1 - admin\n$`},
+		{"excluded path", AccessLogParams{ExcludePaths: []string{"/health", "/static/**"}}, nil, func() *http.Request {
+			return httptest.NewRequest("GET", "/static/js/app.js", nil)
+		}, `^$`},
+		{"sampled out", AccessLogParams{SampleRate: 1e-12}, nil, func() *http.Request {
+			return httptest.NewRequest("GET", "/", nil)
+		}, `^$`},
+		{"errors are not sampled", AccessLogParams{Format: "{{.Status}}", SampleRate: 1e-12}, nil, func() *http.Request {
+			return httptest.NewRequest("GET", "/missing", nil)
+		}, `^404\n$`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			tt.params.Output = &output
+			chain := Middleware(AccessLog(tt.params))
+			if tt.filter != nil {
+				chain = chain.Append(tt.filter)
+			}
+			chain.ApplyToFunc(handler).ServeHTTP(httptest.NewRecorder(), tt.request())
+			if !regexp.MustCompile(tt.want).MatchString(output.String()) {
+				t.Errorf("AccessLog() wrote %q, want match of %s", output.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessLog_json(t *testing.T) {
+	var output bytes.Buffer
+	handler := Middleware(AccessLog(AccessLogParams{Format: AccessLogJSON, Output: &output})).ApplyToFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, r, &HTTPError{Status: 400, Message: "name missing"})
+	})
+	request := httptest.NewRequest("PUT", "/users/1", nil)
+	request.Header.Set("Referer", "https://app.example.org/")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(output.Bytes(), &record); err != nil {
+		t.Fatalf("invalid JSON %q: %v", output.String(), err)
+	}
+	want := map[string]interface{}{"method": "PUT", "uri": "/users/1", "status": 400.0, "bytes": 13.0, "ip": "192.0.2.1",
+		"referer": "https://app.example.org/", "error": "400 name missing"}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("%s = %v, want %v", key, record[key], value)
+		}
+	}
+	for _, key := range []string{"user", "user_agent", "filter", "request_id"} {
+		if _, ok := record[key]; ok {
+			t.Errorf("empty field %s is not omitted", key)
+		}
+	}
+	if _, ok := record["duration_ms"].(float64); !ok {
+		t.Errorf("duration_ms missing in %v", record)
+	}
+}
+
+func TestAccessLog_invalidTemplate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("AccessLog() with invalid template should panic")
+		}
+	}()
+	AccessLog(AccessLogParams{Format: "{{.Status"})
+}
@@ -0,0 +1,304 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+//Argon2id parameters used by HashAPIKeyArgon2id
+const (
+	apiKeyArgon2Passes    = 2
+	apiKeyArgon2Memory    = 19 * 1024
+	apiKeyArgon2Lanes     = 1
+	apiKeyArgon2KeyLength = 32
+)
+
+//APIKey describes a key accepted by APIKeyFilter. Only a hash of the key is stored, either as "sha256:" followed
+//by the hex encoded SHA-256 hash (see HashAPIKey), or as Argon2 hash in PHC string format, e.g.
+//"$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>" (see HashAPIKeyArgon2id).
+//Argon2 hashes are expensive to verify by design, so each Argon2 hashed key needs a Prefix that is not secret
+//(e.g. "ci_" or "team42_") and is not the beginning of the prefix of another Argon2 hashed key.
+//Only the keys with a matching prefix are verified, so that each request computes at most one Argon2 hash.
+//A key with a zero Expires time does not expire.
+type APIKey struct {
+	Name    string    `json:"name"`
+	Hash    string    `json:"hash"`
+	Prefix  string    `json:"prefix,omitempty"`
+	Scopes  []string  `json:"scopes,omitempty"`
+	Roles   []string  `json:"roles,omitempty"`
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+//APIKeyParams configures APIKeyFilter. The key is read from Header, which defaults to X-API-Key.
+//If Header is Authorization, the key is expected in the form "Bearer <key>".
+type APIKeyParams struct {
+	Header string
+	Keys   []APIKey
+}
+
+type apiKeyFilter struct {
+	next   http.Handler
+	header string
+	keys   []apiKeyVerifier
+}
+
+type apiKeyVerifier struct {
+	key    APIKey
+	verify func(presented string, presentedSum []byte) bool
+}
+
+func (af apiKeyFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	presented := r.Header.Get(af.header)
+	if af.header == "Authorization" {
+		presented = bearerToken(presented)
+	}
+	if presented == "" {
+		af.deny(w, r, presented, "missing_key", fmt.Sprintf("API key missing in header %s", af.header))
+		return
+	}
+
+	// all keys are verified without stopping at the first match, so that the time taken does not reveal which key matched
+	presentedSum := sha256.Sum256([]byte(presented))
+	var matched *APIKey
+	for i := range af.keys {
+		verifier := &af.keys[i]
+		if !strings.HasPrefix(presented, verifier.key.Prefix) {
+			continue
+		}
+		if verifier.verify(presented, presentedSum[:]) && matched == nil {
+			matched = &verifier.key
+		}
+	}
+
+	if matched == nil {
+		af.deny(w, r, presented, "invalid_key", "invalid API key")
+		return
+	}
+	if !matched.Expires.IsZero() && time.Now().After(matched.Expires) {
+		af.deny(w, r, presented, "expired_key", fmt.Sprintf("API key %s expired", matched.Name))
+		return
+	}
+	principal := Principal{Subject: matched.Name, Method: "api-key", Scopes: matched.Scopes, Roles: matched.Roles}
+	af.next.ServeHTTP(w, withIdentity(r, apiKeyKey, *matched, principal))
+}
+
+//deny rejects a request without an acceptable key with a challenge for the key: the Bearer challenge of RFC 6750
+//if the key is read from the Authorization header, otherwise an APIKey challenge that names the header
+func (af apiKeyFilter) deny(w http.ResponseWriter, r *http.Request, presented string, code string, reason string) {
+	challenge := fmt.Sprintf("APIKey header=%q", af.header)
+	if af.header == "Authorization" {
+		challenge = bearerChallenge(presented)
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	WriteError(w, r, &DeniedError{Status: 401, Filter: "apikey", Code: code, Reason: reason})
+}
+
+func bearerToken(authorization string) string {
+	const scheme = "Bearer "
+	if len(authorization) > len(scheme) && strings.EqualFold(authorization[:len(scheme)], scheme) {
+		return strings.TrimSpace(authorization[len(scheme):])
+	}
+	return ""
+}
+
+//APIKeyFromContext returns the key accepted by APIKeyFilter
+func APIKeyFromContext(ctx context.Context) (APIKey, bool) {
+	key, ok := ctx.Value(apiKeyKey).(APIKey)
+	return key, ok
+}
+
+//APIKeyFilter permits requests with one of the given API keys, which are compared in constant time.
+//The accepted key (without the key itself) is available to the following handlers with APIKeyFromContext:
+//  keys, err := middleware.LoadAPIKeys("/etc/service/api-keys.json")
+//  requireKey := middleware.APIKeyFilter(middleware.APIKeyParams{Keys: keys})
+//  handler := func(w http.ResponseWriter, r *http.Request) {
+//  	key, _ := middleware.APIKeyFromContext(r.Context())
+//  	fmt.Fprintf(w, "Hi %s!", key.Name)
+//  }
+//Requests with a missing, invalid or expired key are rejected with 401 and a WWW-Authenticate challenge.
+//It panics if one of the hashes is invalid or the prefixes of the Argon2 hashed keys are not unique.
+func APIKeyFilter(params APIKeyParams) func(http.Handler) http.Handler {
+	header := params.Header
+	if header == "" {
+		header = "X-API-Key"
+	}
+	header = textproto.CanonicalMIMEHeaderKey(header)
+	if err := checkAPIKeyPrefixes(params.Keys); err != nil {
+		panic(fmt.Sprintf("Failed to create API key filter: %s", err))
+	}
+	var keys []apiKeyVerifier
+	for _, key := range params.Keys {
+		verify, err := newAPIKeyVerifier(key.Hash)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to parse hash of API key %s: %s", key.Name, err))
+		}
+		keys = append(keys, apiKeyVerifier{key, verify})
+	}
+	fn := func(next http.Handler) http.Handler {
+		return apiKeyFilter{next, header, keys}
+	}
+	return fn
+}
+
+//LoadAPIKeys reads API keys from a JSON file:
+//  [
+//    {"name": "ci", "hash": "sha256:9f86d0...", "scopes": ["deploy"], "expires": "2021-01-01T00:00:00Z"},
+//    {"name": "admin", "hash": "$argon2id$v=19$m=19456,t=2,p=1$...", "prefix": "adm_"}
+//  ]
+func LoadAPIKeys(path string) ([]APIKey, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []APIKey
+	if err := json.Unmarshal(content, &keys); err != nil {
+		return nil, fmt.Errorf("invalid API key file %s: %w", path, err)
+	}
+	for _, key := range keys {
+		if _, err := newAPIKeyVerifier(key.Hash); err != nil {
+			return nil, fmt.Errorf("invalid hash of API key %s in %s: %w", key.Name, path, err)
+		}
+	}
+	if err := checkAPIKeyPrefixes(keys); err != nil {
+		return nil, fmt.Errorf("invalid API key file %s: %w", path, err)
+	}
+	return keys, nil
+}
+
+//checkAPIKeyPrefixes ensures that a presented key matches the prefix of at most one Argon2 hashed key
+func checkAPIKeyPrefixes(keys []APIKey) error {
+	var hashed []APIKey
+	for _, key := range keys {
+		if !strings.HasPrefix(key.Hash, "$argon2") {
+			continue
+		}
+		if key.Prefix == "" {
+			return fmt.Errorf("Argon2 hashed API key %s has no prefix", key.Name)
+		}
+		for _, other := range hashed {
+			if strings.HasPrefix(key.Prefix, other.Prefix) || strings.HasPrefix(other.Prefix, key.Prefix) {
+				return fmt.Errorf("prefixes %s of API key %s and %s of API key %s overlap", key.Prefix, key.Name, other.Prefix, other.Name)
+			}
+		}
+		hashed = append(hashed, key)
+	}
+	return nil
+}
+
+//HashAPIKey returns the SHA-256 hash of a key in the format expected by APIKey.
+//SHA-256 is appropriate for randomly generated keys with at least 128 bits of entropy.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+//HashAPIKeyArgon2id returns the Argon2id hash of a key with a random salt in the format expected by APIKey
+func HashAPIKeyArgon2id(key string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	hash := argon2.IDKey([]byte(key), salt, apiKeyArgon2Passes, apiKeyArgon2Memory, apiKeyArgon2Lanes, apiKeyArgon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, apiKeyArgon2Memory, apiKeyArgon2Passes, apiKeyArgon2Lanes,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+func newAPIKeyVerifier(hash string) (func(string, []byte) bool, error) {
+	if strings.HasPrefix(hash, "sha256:") {
+		expected, err := hex.DecodeString(strings.TrimPrefix(hash, "sha256:"))
+		if err != nil || len(expected) != sha256.Size {
+			return nil, fmt.Errorf("invalid SHA-256 hash")
+		}
+		return func(presented string, presentedSum []byte) bool {
+			return subtle.ConstantTimeCompare(expected, presentedSum) == 1
+		}, nil
+	}
+	if strings.HasPrefix(hash, "$argon2") {
+		params, err := parseArgon2Hash(hash)
+		if err != nil {
+			return nil, err
+		}
+		return func(presented string, presentedSum []byte) bool {
+			computed := params.key([]byte(presented), params.salt, params.passes, params.memory, params.lanes, uint32(len(params.hash)))
+			return subtle.ConstantTimeCompare(params.hash, computed) == 1
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported hash format")
+}
+
+type argon2Params struct {
+	key    func(password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) []byte
+	passes uint32
+	memory uint32
+	lanes  uint8
+	salt   []byte
+	hash   []byte
+}
+
+//parseArgon2Hash parses an Argon2 hash in PHC string format: $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>
+func parseArgon2Hash(hash string) (argon2Params, error) {
+	var params argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" {
+		return params, fmt.Errorf("invalid Argon2 hash format")
+	}
+	switch parts[1] {
+	case "argon2i":
+		params.key = argon2.Key
+	case "argon2id":
+		params.key = argon2.IDKey
+	default:
+		return params, fmt.Errorf("unsupported Argon2 variant %s", parts[1])
+	}
+	if parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return params, fmt.Errorf("unsupported Argon2 version %s", parts[2])
+	}
+	for _, param := range strings.Split(parts[3], ",") {
+		keyValue := strings.SplitN(param, "=", 2)
+		if len(keyValue) != 2 {
+			return params, fmt.Errorf("invalid Argon2 parameter %s", param)
+		}
+		value, err := strconv.ParseUint(keyValue[1], 10, 32)
+		if err != nil || value == 0 {
+			return params, fmt.Errorf("invalid Argon2 parameter %s", param)
+		}
+		switch keyValue[0] {
+		case "m":
+			params.memory = uint32(value)
+		case "t":
+			params.passes = uint32(value)
+		case "p":
+			if value > 255 {
+				return params, fmt.Errorf("invalid Argon2 parameter %s", param)
+			}
+			params.lanes = uint8(value)
+		default:
+			return params, fmt.Errorf("unknown Argon2 parameter %s", param)
+		}
+	}
+	if params.memory == 0 || params.passes == 0 || params.lanes == 0 {
+		return params, fmt.Errorf("missing Argon2 parameters")
+	}
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, fmt.Errorf("invalid Argon2 salt: %w", err)
+	}
+	if params.hash, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(params.hash) < 4 {
+		return params, fmt.Errorf("invalid Argon2 hash")
+	}
+	return params, nil
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_newAPIKeyVerifier(t *testing.T) {
+	argon2idHash, err := HashAPIKeyArgon2id("adm_secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		hash      string
+		presented string
+		want      bool
+		wantErr   bool
+	}{
+		{"SHA-256", HashAPIKey("secret"), "secret", true, false},
+		{"SHA-256 wrong key", HashAPIKey("secret"), "guess", false, false},
+		{"SHA-256 invalid hex", "sha256:xyz", "", false, true},
+		{"SHA-256 wrong length", "sha256:abcd", "", false, true},
+		{"Argon2id", argon2idHash, "adm_secret", true, false},
+		{"Argon2id wrong key", argon2idHash, "adm_guess", false, false},
+		//from the Argon2 reference implementation
+		{"Argon2i reference", "$argon2i$v=19$m=65536,t=2,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG", "password", true, false},
+		{"Argon2 wrong version", "$argon2id$v=16$m=16,t=2,p=1$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG", "", false, true},
+		{"Argon2 unknown variant", "$argon2x$v=19$m=16,t=2,p=1$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG", "", false, true},
+		{"Argon2 missing parameter", "$argon2id$v=19$m=16,t=2$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG", "", false, true},
+		{"Argon2 invalid salt", "$argon2id$v=19$m=16,t=2,p=1$!!!$RdescudvJCsgt3ub+b+dWRWJTmaaJObG", "", false, true},
+		{"unknown format", "md5:abc", "", false, true},
+		{"plaintext", "secret", "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verify, err := newAPIKeyVerifier(tt.hash)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newAPIKeyVerifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			sum := sha256.Sum256([]byte(tt.presented))
+			if got := verify(tt.presented, sum[:]); got != tt.want {
+				t.Errorf("verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIKeyFilter(t *testing.T) {
+	keys := []APIKey{
+		{Name: "ci", Hash: HashAPIKey("ci-secret"), Scopes: []string{"deploy"}},
+		{Name: "old", Hash: HashAPIKey("old-secret"), Expires: time.Now().Add(-time.Hour)},
+		{Name: "prefixed", Hash: HashAPIKey("adm_secret"), Prefix: "adm_"},
+	}
+	tests := []struct {
+		name          string
+		params        APIKeyParams
+		header        http.Header
+		want          int
+		wantName      string
+		wantChallenge string
+	}{
+		{"valid key", APIKeyParams{Keys: keys}, http.Header{"X-Api-Key": {"ci-secret"}}, 200, "ci", ""},
+		{"invalid key", APIKeyParams{Keys: keys}, http.Header{"X-Api-Key": {"guess"}}, 401, "", `APIKey header="X-Api-Key"`},
+		{"missing key", APIKeyParams{Keys: keys}, http.Header{}, 401, "", `APIKey header="X-Api-Key"`},
+		{"expired key", APIKeyParams{Keys: keys}, http.Header{"X-Api-Key": {"old-secret"}}, 401, "", `APIKey header="X-Api-Key"`},
+		{"key with prefix", APIKeyParams{Keys: keys}, http.Header{"X-Api-Key": {"adm_secret"}}, 200, "prefixed", ""},
+		{"custom header", APIKeyParams{Header: "x-token", Keys: keys}, http.Header{"X-Token": {"ci-secret"}}, 200, "ci", ""},
+		{"bearer token", APIKeyParams{Header: "Authorization", Keys: keys}, http.Header{"Authorization": {"bearer ci-secret"}}, 200, "ci", ""},
+		{"invalid bearer token", APIKeyParams{Header: "Authorization", Keys: keys}, http.Header{"Authorization": {"Bearer guess"}}, 401, "", `Bearer error="invalid_token"`},
+		{"authorization without bearer", APIKeyParams{Header: "Authorization", Keys: keys}, http.Header{"Authorization": {"ci-secret"}}, 401, "", "Bearer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var key APIKey
+			handler := APIKeyFilter(tt.params)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				key, _ = APIKeyFromContext(r.Context())
+			}))
+			request := httptest.NewRequest("GET", "/", nil)
+			request.Header = tt.header
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != tt.want {
+				t.Errorf("APIKeyFilter() status = %d, want %d", recorder.Code, tt.want)
+			}
+			if key.Name != tt.wantName {
+				t.Errorf("APIKeyFromContext() name = %s, want %s", key.Name, tt.wantName)
+			}
+			if challenge := recorder.Header().Get("WWW-Authenticate"); challenge != tt.wantChallenge {
+				t.Errorf("APIKeyFilter() challenge = %s, want %s", challenge, tt.wantChallenge)
+			}
+		})
+	}
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	path := writeTestFile(t, "keys.json", `[
+		{"name": "ci", "hash": "`+HashAPIKey("ci-secret")+`", "scopes": ["deploy"], "expires": "2030-01-01T00:00:00Z"},
+		{"name": "admin", "hash": "$argon2i$v=19$m=65536,t=2,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG", "prefix": "adm_"}
+	]`)
+	keys, err := LoadAPIKeys(path)
+	if err != nil {
+		t.Fatalf("LoadAPIKeys() error = %v", err)
+	}
+	if len(keys) != 2 || keys[0].Scopes[0] != "deploy" || keys[0].Expires.Year() != 2030 || keys[1].Prefix != "adm_" {
+		t.Errorf("LoadAPIKeys() = %+v", keys)
+	}
+
+	invalid := writeTestFile(t, "invalid.json", `[{"name": "plain", "hash": "secret"}]`)
+	if _, err := LoadAPIKeys(invalid); err == nil {
+		t.Errorf("LoadAPIKeys() with plaintext key: expected error")
+	}
+}
+
+func Test_checkAPIKeyPrefixes(t *testing.T) {
+	const argon2Hash = "$argon2i$v=19$m=65536,t=2,p=4$c29tZXNhbHQ$RdescudvJCsgt3ub+b+dWRWJTmaaJObG"
+	tests := []struct {
+		name    string
+		keys    []APIKey
+		wantErr bool
+	}{
+		{"SHA-256 without prefix", []APIKey{{Name: "a", Hash: HashAPIKey("a")}, {Name: "b", Hash: HashAPIKey("b")}}, false},
+		{"distinct prefixes", []APIKey{{Name: "a", Hash: argon2Hash, Prefix: "ci_"}, {Name: "b", Hash: argon2Hash, Prefix: "adm_"}}, false},
+		{"Argon2 without prefix", []APIKey{{Name: "a", Hash: argon2Hash}}, true},
+		{"same prefix", []APIKey{{Name: "a", Hash: argon2Hash, Prefix: "ci_"}, {Name: "b", Hash: argon2Hash, Prefix: "ci_"}}, true},
+		{"overlapping prefixes", []APIKey{{Name: "a", Hash: argon2Hash, Prefix: "team_"}, {Name: "b", Hash: argon2Hash, Prefix: "team_42_"}}, true},
+		{"SHA-256 with same prefix", []APIKey{{Name: "a", Hash: argon2Hash, Prefix: "ci_"}, {Name: "b", Hash: HashAPIKey("b"), Prefix: "ci_"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkAPIKeyPrefixes(tt.keys); (err != nil) != tt.wantErr {
+				t.Errorf("checkAPIKeyPrefixes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
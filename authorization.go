@@ -0,0 +1,254 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+//Policy decides whether a principal is authorized. Policies can be combined with And, Or and Not,
+//or written as expressions with ParsePolicy.
+type Policy func(principal Principal) bool
+
+//RequireScopes is satisfied if the principal has all of the scopes
+func RequireScopes(scopes ...string) Policy {
+	return func(principal Principal) bool {
+		for _, scope := range scopes {
+			if !principal.HasScope(scope) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+//RequireRoles is satisfied if the principal has all of the roles
+func RequireRoles(roles ...string) Policy {
+	return func(principal Principal) bool {
+		for _, role := range roles {
+			if !principal.HasRole(role) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+//RequireSubject is satisfied if the principal is one of the subjects
+func RequireSubject(subjects ...string) Policy {
+	return func(principal Principal) bool {
+		return contains(subjects, principal.Subject)
+	}
+}
+
+//RequireMethod is satisfied if the principal was authenticated with one of the methods, e.g. "client-cert"
+func RequireMethod(methods ...string) Policy {
+	return func(principal Principal) bool {
+		return contains(methods, principal.Method)
+	}
+}
+
+//And returns a policy that is satisfied if policy and all others are satisfied
+func (policy Policy) And(others ...Policy) Policy {
+	return func(principal Principal) bool {
+		if !policy(principal) {
+			return false
+		}
+		for _, other := range others {
+			if !other(principal) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+//Or returns a policy that is satisfied if policy or any of the others is satisfied
+func (policy Policy) Or(others ...Policy) Policy {
+	return func(principal Principal) bool {
+		if policy(principal) {
+			return true
+		}
+		for _, other := range others {
+			if other(principal) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//Not returns a policy that is satisfied if policy is not satisfied
+func (policy Policy) Not() Policy {
+	return func(principal Principal) bool {
+		return !policy(principal)
+	}
+}
+
+//ParsePolicy parses a policy expression. Expressions consist of the terms scope:<scope>, role:<role>,
+//subject:<subject> and method:<method>, combined with and, or, not and parentheses. and binds more
+//strongly than or:
+//  scope:orders:read and (role:admin or role:support) and not method:basic
+func ParsePolicy(expression string) (Policy, error) {
+	parser := &policyParser{tokens: tokenizePolicy(expression)}
+	if len(parser.tokens) == 0 {
+		return nil, fmt.Errorf("empty policy expression")
+	}
+	policy, err := parser.or()
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy expression %q: %w", expression, err)
+	}
+	if parser.position < len(parser.tokens) {
+		return nil, fmt.Errorf("invalid policy expression %q: unexpected %s", expression, parser.tokens[parser.position])
+	}
+	return policy, nil
+}
+
+//MustParsePolicy is like ParsePolicy, but panics if the expression is invalid
+func MustParsePolicy(expression string) Policy {
+	policy, err := ParsePolicy(expression)
+	if err != nil {
+		panic(err)
+	}
+	return policy
+}
+
+func tokenizePolicy(expression string) []string {
+	expression = strings.NewReplacer("(", " ( ", ")", " ) ").Replace(expression)
+	return strings.Fields(expression)
+}
+
+//policyParser is a recursive descent parser for policy expressions
+type policyParser struct {
+	tokens   []string
+	position int
+}
+
+func (p *policyParser) next() string {
+	if p.position >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.position]
+}
+
+func (p *policyParser) or() (Policy, error) {
+	policy, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.next() == "or" {
+		p.position++
+		other, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		policy = policy.Or(other)
+	}
+	return policy, nil
+}
+
+func (p *policyParser) and() (Policy, error) {
+	policy, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.next() == "and" {
+		p.position++
+		other, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		policy = policy.And(other)
+	}
+	return policy, nil
+}
+
+func (p *policyParser) unary() (Policy, error) {
+	token := p.next()
+	p.position++
+	switch token {
+	case "":
+		return nil, fmt.Errorf("unexpected end")
+	case "not":
+		policy, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return policy.Not(), nil
+	case "(":
+		policy, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.position++
+		return policy, nil
+	}
+	kind, value, found := strings.Cut(token, ":")
+	if !found || value == "" {
+		return nil, fmt.Errorf("unexpected %s", token)
+	}
+	switch kind {
+	case "scope":
+		return RequireScopes(value), nil
+	case "role":
+		return RequireRoles(value), nil
+	case "subject":
+		return RequireSubject(value), nil
+	case "method":
+		return RequireMethod(value), nil
+	default:
+		return nil, fmt.Errorf("unknown term %s", token)
+	}
+}
+
+//AuthorizationParams configures Authorize. Requests with a method listed in Methods must satisfy its policy,
+//all other requests must satisfy Policy. If there is no policy for a request, it is denied.
+type AuthorizationParams struct {
+	Policy  Policy
+	Methods map[string]Policy
+}
+
+type authorizationFilter struct {
+	next   http.Handler
+	params AuthorizationParams
+}
+
+func (af authorizationFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		WriteError(w, r, &DeniedError{Status: 403, Filter: "authorization", Code: "unauthenticated", Reason: "not authenticated"})
+		return
+	}
+	policy, ok := af.params.Methods[r.Method]
+	if !ok {
+		policy = af.params.Policy
+	}
+	if policy == nil || !policy(principal) {
+		reason := fmt.Sprintf("%s %s is not authorized for %s", principal.Method, principal.Subject, r.Method)
+		WriteError(w, r, &DeniedError{Status: 403, Filter: "authorization", Code: "forbidden", Reason: reason})
+		return
+	}
+	af.next.ServeHTTP(w, r)
+}
+
+//Authorize permits requests whose principal, published by one of the authenticating filters earlier in the chain,
+//satisfies the policy for the request method. Requests without a principal are denied with status 403, as only the
+//authenticating filters know which credentials to challenge for with a 401:
+//  requireToken := middleware.JWTFilter(middleware.JWTParams{KeySet: keys})
+//  orders := middleware.Authorize(middleware.AuthorizationParams{
+//  	Policy: middleware.RequireScopes("orders:read"),
+//  	Methods: map[string]middleware.Policy{
+//  		"POST":   middleware.MustParsePolicy("scope:orders:write or role:admin"),
+//  		"DELETE": middleware.RequireRoles("admin"),
+//  	},
+//  })
+//  mux.Handle("/orders", middleware.Assemble(requireToken, orders).ApplyToFunc(handler))
+func Authorize(params AuthorizationParams) func(http.Handler) http.Handler {
+	fn := func(next http.Handler) http.Handler {
+		return authorizationFilter{next, params}
+	}
+	return fn
+}
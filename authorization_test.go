@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParsePolicy(t *testing.T) {
+	admin := Principal{Subject: "alice", Method: "jwt", Scopes: []string{"orders:read"}, Roles: []string{"admin"}}
+	reader := Principal{Subject: "bob", Method: "basic", Scopes: []string{"orders:read"}}
+	tests := []struct {
+		expression string
+		principal  Principal
+		want       bool
+		wantErr    bool
+	}{
+		{"scope:orders:read", reader, true, false},
+		{"scope:orders:write", reader, false, false},
+		{"role:admin", admin, true, false},
+		{"subject:bob", reader, true, false},
+		{"method:jwt", reader, false, false},
+		{"scope:orders:read and role:admin", reader, false, false},
+		{"scope:orders:read and role:admin", admin, true, false},
+		{"role:admin or subject:bob", reader, true, false},
+		{"not method:basic", reader, false, false},
+		{"role:support or role:admin and method:basic", admin, false, false},
+		{"(role:support or role:admin) and method:jwt", admin, true, false},
+		{"scope:orders:read and not (method:basic or subject:carol)", admin, true, false},
+		{"", reader, false, true},
+		{"scope:", reader, false, true},
+		{"group:admin", reader, false, true},
+		{"role:admin and", reader, false, true},
+		{"(role:admin", reader, false, true},
+		{"role:admin)", reader, false, true},
+		{"role:admin role:support", reader, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			policy, err := ParsePolicy(tt.expression)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && policy(tt.principal) != tt.want {
+				t.Errorf("ParsePolicy(%q)(%v) = %v, want %v", tt.expression, tt.principal, !tt.want, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	params := AuthorizationParams{
+		Policy: RequireScopes("orders:read"),
+		Methods: map[string]Policy{
+			"POST":   RequireScopes("orders:write").Or(RequireRoles("admin")),
+			"DELETE": RequireRoles("admin").And(RequireMethod("client-cert")),
+		},
+	}
+	reader := &Principal{Subject: "bob", Method: "api-key", Scopes: []string{"orders:read"}}
+	admin := &Principal{Subject: "alice", Method: "jwt", Roles: []string{"admin"}}
+	tests := []struct {
+		name      string
+		params    AuthorizationParams
+		method    string
+		principal *Principal
+		want      int
+	}{
+		{"default policy", params, "GET", reader, 200},
+		{"default policy not satisfied", params, "GET", admin, 403},
+		{"method policy", params, "POST", admin, 200},
+		{"method policy not satisfied", params, "POST", reader, 403},
+		{"combined method policy", params, "DELETE", admin, 403},
+		{"not authenticated", params, "GET", nil, 403},
+		{"no policy", AuthorizationParams{Methods: map[string]Policy{"GET": RequireScopes()}}, "PUT", reader, 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := Authorize(tt.params)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			request := httptest.NewRequest(tt.method, "/orders", nil)
+			if tt.principal != nil {
+				request = request.WithContext(context.WithValue(request.Context(), principalKey, *tt.principal))
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != tt.want {
+				t.Errorf("Authorize() status = %d, want %d", recorder.Code, tt.want)
+			}
+		})
+	}
+}
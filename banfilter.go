@@ -0,0 +1,267 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/textproto"
+	"sync"
+	"time"
+)
+
+//BanParams configures a BanList.
+//A client is banned once it has failed MaxFailures times (default 5). Failures decay over time: one failure is
+//forgotten per FailureDecay (default 1 minute). The first ban lasts BanDuration (default 10 minutes), every further ban
+//of the same client lasts twice as long as the previous one, up to MaxBanDuration (default 24 hours).
+//Clients are remembered as repeat offenders for MaxBanDuration after their last ban ended.
+//At most MaxEntries clients (default 10000) are tracked.
+type BanParams struct {
+	MaxFailures    int
+	FailureDecay   time.Duration
+	BanDuration    time.Duration
+	MaxBanDuration time.Duration
+	MaxEntries     int
+}
+
+//BanList tracks failed requests per client ip and bans clients that fail too often, similar to fail2ban.
+//It is safe for concurrent use and can be shared by several BanFilters.
+type BanList struct {
+	mutex   sync.Mutex
+	params  BanParams
+	entries map[string]*banEntry
+	now     func() time.Time
+}
+
+type banEntry struct {
+	failures    int
+	decayedAt   time.Time
+	offenses    int
+	bannedUntil time.Time
+}
+
+//NewBanList creates an empty BanList
+func NewBanList(params BanParams) *BanList {
+	if params.MaxFailures <= 0 {
+		params.MaxFailures = 5
+	}
+	if params.FailureDecay <= 0 {
+		params.FailureDecay = time.Minute
+	}
+	if params.BanDuration <= 0 {
+		params.BanDuration = 10 * time.Minute
+	}
+	if params.MaxBanDuration < params.BanDuration {
+		params.MaxBanDuration = 24 * time.Hour
+		if params.MaxBanDuration < params.BanDuration {
+			params.MaxBanDuration = params.BanDuration
+		}
+	}
+	if params.MaxEntries <= 0 {
+		params.MaxEntries = 10000
+	}
+	return &BanList{params: params, entries: make(map[string]*banEntry), now: time.Now}
+}
+
+//Failure records a failed request of the client with the given ip address (with or without port)
+//and returns true if the client is banned afterwards.
+func (b *BanList) Failure(ip string) bool {
+	ip = normalizeIP(ip)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := b.now()
+
+	entry, ok := b.entries[ip]
+	if ok && b.expired(entry, now) {
+		*entry = banEntry{}
+	}
+	if !ok {
+		if !b.makeRoom(now) {
+			return false
+		}
+		entry = &banEntry{}
+		b.entries[ip] = entry
+	}
+	if now.Before(entry.bannedUntil) {
+		return true
+	}
+	b.decay(entry, now)
+	entry.failures++
+	if entry.failures < b.params.MaxFailures {
+		return false
+	}
+
+	duration := b.params.BanDuration
+	for i := 0; i < entry.offenses && duration < b.params.MaxBanDuration; i++ {
+		duration *= 2
+	}
+	if duration > b.params.MaxBanDuration {
+		duration = b.params.MaxBanDuration
+	}
+	entry.offenses++
+	entry.failures = 0
+	entry.bannedUntil = now.Add(duration)
+	log.Printf("IP %s is banned for %s after repeated failures \n", ip, duration)
+	return true
+}
+
+//IsBanned reports whether the client with the given ip address is banned, and until when
+func (b *BanList) IsBanned(ip string) (bool, time.Time) {
+	ip = normalizeIP(ip)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	entry, ok := b.entries[ip]
+	if !ok || !b.now().Before(entry.bannedUntil) {
+		return false, time.Time{}
+	}
+	return true, entry.bannedUntil
+}
+
+//Ban bans the client with the given ip address for duration, regardless of previous failures.
+//It returns false if the client could not be banned, because MaxEntries other clients are banned already.
+func (b *BanList) Ban(ip string, duration time.Duration) bool {
+	ip = normalizeIP(ip)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := b.now()
+	entry, ok := b.entries[ip]
+	if !ok {
+		if !b.makeRoom(now) {
+			return false
+		}
+		entry = &banEntry{}
+		b.entries[ip] = entry
+	}
+	entry.offenses++
+	entry.bannedUntil = now.Add(duration)
+	return true
+}
+
+//Unban lifts the ban of the client with the given ip address and forgets its previous failures and bans
+func (b *BanList) Unban(ip string) {
+	ip = normalizeIP(ip)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.entries, ip)
+}
+
+//Banned returns all currently banned ip addresses and the end of their bans
+func (b *BanList) Banned() map[string]time.Time {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := b.now()
+	banned := make(map[string]time.Time)
+	for ip, entry := range b.entries {
+		if now.Before(entry.bannedUntil) {
+			banned[ip] = entry.bannedUntil
+		}
+	}
+	return banned
+}
+
+//decay forgets one failure for every FailureDecay that has passed since the last decay
+func (b *BanList) decay(entry *banEntry, now time.Time) {
+	intervals := int(now.Sub(entry.decayedAt) / b.params.FailureDecay)
+	if intervals >= entry.failures {
+		entry.failures = 0
+		entry.decayedAt = now
+		return
+	}
+	entry.failures -= intervals
+	entry.decayedAt = entry.decayedAt.Add(time.Duration(intervals) * b.params.FailureDecay)
+}
+
+func (b *BanList) expired(entry *banEntry, now time.Time) bool {
+	b.decay(entry, now)
+	return entry.failures == 0 && now.After(entry.bannedUntil.Add(b.params.MaxBanDuration))
+}
+
+//makeRoom removes expired entries if the list is full and reports whether another entry can be added.
+//If there are no expired entries, a client that is not banned is forgotten instead.
+func (b *BanList) makeRoom(now time.Time) bool {
+	if len(b.entries) < b.params.MaxEntries {
+		return true
+	}
+	for ip, entry := range b.entries {
+		if b.expired(entry, now) {
+			delete(b.entries, ip)
+		}
+	}
+	if len(b.entries) < b.params.MaxEntries {
+		return true
+	}
+	for ip, entry := range b.entries {
+		if !now.Before(entry.bannedUntil) {
+			delete(b.entries, ip)
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeIP(ip string) string {
+	if address := getIpFromString(ip); address != nil {
+		return address.String()
+	}
+	return ip
+}
+
+//banFilters are the filters whose denials count as failures of the client
+var banFilters = map[string]bool{"hmac": true, "header": true}
+
+//banScope notes whether a filter following a BanFilter denied the request
+type banScope struct {
+	parent *banScope
+	failed bool
+}
+
+//recordFailure notes the error for the BanFilters of the request, if it is a denial of one of the banFilters
+func recordFailure(ctx context.Context, err error) {
+	var denied *DeniedError
+	if !errors.As(err, &denied) || !banFilters[denied.Filter] {
+		return
+	}
+	scope, _ := ctx.Value(banScopeKey).(*banScope)
+	for ; scope != nil; scope = scope.parent {
+		scope.failed = true
+	}
+}
+
+type banFilter struct {
+	next     http.Handler
+	list     *BanList
+	ipHeader string
+}
+
+func (bf banFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ip, ok := clientIP(r, bf.ipHeader)
+	if !ok {
+		denyMissingIPHeader(w, r, "ban", bf.ipHeader)
+		return
+	}
+	if banned, until := bf.list.IsBanned(ip); banned {
+		WriteError(w, r, &DeniedError{Status: 403, Filter: "ban", Code: "banned", Reason: "banned until " + until.Format(time.RFC3339), IP: ip})
+		return
+	}
+	parent, _ := r.Context().Value(banScopeKey).(*banScope)
+	scope := &banScope{parent: parent}
+	bf.next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), banScopeKey, scope)))
+	if scope.failed {
+		bf.list.Failure(ip)
+	}
+}
+
+//BanFilter rejects requests from clients that are banned in list. Requests that are rejected by the following
+//HmacFilter or FilterHeaders count as failures of the client, so it has to be placed in front of them.
+//Other responses, e.g. the challenges of BasicAuth or a 403 of the application, are not counted:
+//  bans := middleware.NewBanList(middleware.BanParams{MaxFailures: 10})
+//  webhook := middleware.Assemble(middleware.BanFilter(bans, ""), githubSignature)
+//  mux.Handle("/admin/unban", unbanHandler(bans)) // calls bans.Unban(ip)
+//The header parameter has the same meaning as for IPFilter, requests without it are rejected.
+func BanFilter(list *BanList, header string) func(http.Handler) http.Handler {
+	header = textproto.CanonicalMIMEHeaderKey(header)
+	fn := func(next http.Handler) http.Handler {
+		return banFilter{next, list, header}
+	}
+	return fn
+}
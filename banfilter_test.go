@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBanList(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	bans := NewBanList(BanParams{MaxFailures: 3, FailureDecay: time.Minute, BanDuration: time.Minute, MaxBanDuration: 3 * time.Minute})
+	bans.now = func() time.Time { return now }
+
+	fail := func(times int) bool {
+		banned := false
+		for i := 0; i < times; i++ {
+			banned = bans.Failure("10.0.0.1:1234")
+		}
+		return banned
+	}
+
+	if fail(2) {
+		t.Errorf("Failure() banned before MaxFailures")
+	}
+	now = now.Add(90 * time.Second)
+	if fail(1) {
+		t.Errorf("Failure() banned although failures decayed")
+	}
+	if !fail(2) {
+		t.Errorf("Failure() not banned after MaxFailures")
+	}
+	if banned, until := bans.IsBanned("10.0.0.1"); !banned || !until.Equal(now.Add(time.Minute)) {
+		t.Errorf("IsBanned() = %v, %v, want first ban of 1 minute", banned, until)
+	}
+	if banned, _ := bans.IsBanned("10.0.0.2:1234"); banned {
+		t.Errorf("IsBanned() other client should not be banned")
+	}
+
+	durations := []time.Duration{2 * time.Minute, 3 * time.Minute, 3 * time.Minute}
+	for _, want := range durations {
+		now = now.Add(time.Hour)
+		if banned, _ := bans.IsBanned("10.0.0.1"); banned {
+			t.Fatalf("IsBanned() ban should have ended")
+		}
+		now = now.Add(-time.Hour + 3*time.Minute)
+		fail(3)
+		if _, until := bans.IsBanned("10.0.0.1"); !until.Equal(now.Add(want)) {
+			t.Errorf("IsBanned() until %v, want escalated ban of %v", until, want)
+		}
+	}
+
+	bans.Unban("10.0.0.1:4321")
+	if banned, _ := bans.IsBanned("10.0.0.1"); banned {
+		t.Errorf("IsBanned() after Unban should be false")
+	}
+	fail(3)
+	if _, until := bans.IsBanned("10.0.0.1"); !until.Equal(now.Add(time.Minute)) {
+		t.Errorf("IsBanned() after Unban: previous bans should be forgotten")
+	}
+
+	bans.Ban("[::1]:1234", time.Hour)
+	banned := bans.Banned()
+	if len(banned) != 2 || !banned["::1"].Equal(now.Add(time.Hour)) {
+		t.Errorf("Banned() = %v", banned)
+	}
+}
+
+func TestBanList_MaxEntries(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	bans := NewBanList(BanParams{MaxFailures: 1, MaxEntries: 2})
+	bans.now = func() time.Time { return now }
+
+	bans.Failure("10.0.0.1")
+	bans.Failure("10.0.0.2")
+	if bans.Failure("10.0.0.3") {
+		t.Errorf("Failure() should not track more than MaxEntries banned clients")
+	}
+	if len(bans.entries) != 2 {
+		t.Errorf("entries = %d, want 2", len(bans.entries))
+	}
+	if bans.Ban("10.0.0.3", time.Hour) || len(bans.entries) != 2 {
+		t.Errorf("Ban() should not track more than MaxEntries banned clients, entries = %d", len(bans.entries))
+	}
+	bans.Unban("10.0.0.1")
+	if !bans.Failure("10.0.0.3") {
+		t.Errorf("Failure() should track client after an entry was removed")
+	}
+}
+
+func TestBanFilter(t *testing.T) {
+	bans := NewBanList(BanParams{MaxFailures: 2})
+	chain := Assemble(BanFilter(bans, ""), FilterHeaders(http.Header{"Secretkey": {"secretvalue"}}))
+	handler := chain.ApplyToFunc(func(w http.ResponseWriter, r *http.Request) {})
+	send := func(remoteAddr string, secret string) int {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.RemoteAddr = remoteAddr
+		request.Header.Set("Secretkey", secret)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		secret     string
+		want       int
+	}{
+		{"valid secret", "10.0.0.1:1000", "secretvalue", 200},
+		{"first failure", "10.0.0.1:1001", "guess1", 403},
+		{"second failure", "10.0.0.1:1002", "guess2", 403},
+		{"valid secret while banned", "10.0.0.1:1003", "secretvalue", 403},
+		{"other client", "10.0.0.2:1000", "secretvalue", 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := send(tt.remoteAddr, tt.secret); got != tt.want {
+				t.Errorf("BanFilter() status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+	if banned, _ := bans.IsBanned("10.0.0.1"); !banned {
+		t.Errorf("IsBanned() client should be banned after failures")
+	}
+}
+
+func TestBanFilter_otherDenials(t *testing.T) {
+	bans := NewBanList(BanParams{MaxFailures: 1})
+	handler := BanFilter(bans, "")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, r, &DeniedError{Status: 403, Filter: "authorization", Code: "forbidden"})
+	}))
+	for i := 0; i < 3; i++ {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.RemoteAddr = "10.0.0.1:1000"
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != 403 {
+			t.Fatalf("BanFilter() status = %d, want 403", recorder.Code)
+		}
+	}
+	if banned, _ := bans.IsBanned("10.0.0.1"); banned {
+		t.Errorf("IsBanned() denials of other filters should not count as failures")
+	}
+}
+
+func TestBanFilter_missingHeader(t *testing.T) {
+	bans := NewBanList(BanParams{MaxFailures: 1})
+	chain := Assemble(BanFilter(bans, "X-Forwarded-For"), FilterHeaders(http.Header{"Secretkey": {"secretvalue"}}))
+	handler := chain.ApplyToFunc(func(w http.ResponseWriter, r *http.Request) {})
+	request := httptest.NewRequest("GET", "/", nil)
+	request.RemoteAddr = "10.0.0.1:1000"
+	request.Header.Set("Secretkey", "guess")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != 403 {
+		t.Errorf("BanFilter() status = %d, want 403", recorder.Code)
+	}
+	if banned, _ := bans.IsBanned("10.0.0.1"); banned {
+		t.Errorf("IsBanned() proxy should not be banned for a request without ip header")
+	}
+}
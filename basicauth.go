@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+//htpasswdDummyHash is verified for unknown users, so that the time taken does not reveal whether a user exists
+const htpasswdDummyHash = "$2y$10$middlewaredummyhash...HEV1II8uGn0Cvj5MQRnuUDbgKzZj7.y"
+
+var htpasswdDummyVerifier, _ = newBcryptVerifier(htpasswdDummyHash)
+
+//Htpasswd is a set of users and password hashes read from an htpasswd file, that can be replaced atomically
+//while it is used by a BasicAuthFilter. Supported are bcrypt hashes ("$2y$", created with htpasswd -B),
+//SHA-256-crypt ("$5$") and SHA-512-crypt ("$6$", e.g. created with openssl passwd -6) hashes.
+type Htpasswd struct {
+	users atomic.Value // map[string]func(password string) bool
+}
+
+//LoadHtpasswd reads an htpasswd file with one "user:hash" entry per line.
+//Empty lines and lines starting with # are ignored:
+//  # created with htpasswd -B -C 12
+//  alice:$2y$12$...
+//  bob:$6$rounds=100000$...
+func LoadHtpasswd(path string) (*Htpasswd, error) {
+	htpasswd := &Htpasswd{}
+	if err := htpasswd.ReplaceFromFile(path); err != nil {
+		return nil, err
+	}
+	return htpasswd, nil
+}
+
+//ReplaceFromFile atomically swaps the users with the ones read from an htpasswd file.
+//If the file cannot be read or contains an unsupported hash, the users are left unchanged.
+func (h *Htpasswd) ReplaceFromFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	users := make(map[string]func(string) bool)
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, found := strings.Cut(line, ":")
+		if !found || user == "" {
+			return fmt.Errorf("invalid entry in %s line %d", path, lineNumber)
+		}
+		verify, err := newPasswordVerifier(hash)
+		if err != nil {
+			return fmt.Errorf("invalid hash for user %s in %s line %d: %w", user, path, lineNumber, err)
+		}
+		users[user] = verify
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	h.users.Store(users)
+	return nil
+}
+
+func newPasswordVerifier(hash string) (func(string) bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		return newBcryptVerifier(hash)
+	case strings.HasPrefix(hash, "$5$"), strings.HasPrefix(hash, "$6$"):
+		return newSHACryptVerifier(hash)
+	case strings.HasPrefix(hash, "$apr1$"), strings.HasPrefix(hash, "{SHA}"):
+		return nil, fmt.Errorf("insecure hash algorithm, use bcrypt (htpasswd -B)")
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm")
+	}
+}
+
+//newBcryptVerifier returns a function that reports whether a password matches the bcrypt hash
+func newBcryptVerifier(hash string) (func(password string) bool, error) {
+	if len(hash) < 4 || !strings.Contains("aby", hash[2:3]) || hash[3] != '$' {
+		return nil, fmt.Errorf("unsupported bcrypt version")
+	}
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return nil, fmt.Errorf("invalid bcrypt hash: %w", err)
+	}
+	return func(password string) bool {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}, nil
+}
+
+//Verify reports whether the password of the user is correct
+func (h *Htpasswd) Verify(user string, password string) bool {
+	users, _ := h.users.Load().(map[string]func(string) bool)
+	verify, ok := users[user]
+	if !ok {
+		htpasswdDummyVerifier(password)
+		return false
+	}
+	return verify(password)
+}
+
+//Watch checks the htpasswd file at path for modifications every interval and replaces the users
+//whenever it has changed. If the changed file is invalid, the previous users are kept and an error is logged.
+//Watching stops when the returned function is called. An interval of zero or less defaults to 10 seconds.
+//  users, err := middleware.LoadHtpasswd("/etc/service/htpasswd")
+//  stop := users.Watch("/etc/service/htpasswd", 10*time.Second)
+//  defer stop()
+func (h *Htpasswd) Watch(path string, interval time.Duration) (stop func()) {
+	return watchFile(path, interval, func() {
+		if err := h.ReplaceFromFile(path); err != nil {
+			log.Printf("Failed to reload htpasswd file, keeping previous users: %v \n", err)
+		}
+	})
+}
+
+//BasicAuthParams configures BasicAuthFilter. Realm (default "Restricted") is sent to the client in the
+//WWW-Authenticate challenge.
+type BasicAuthParams struct {
+	Realm string
+	Users *Htpasswd
+}
+
+type basicAuthFilter struct {
+	next      http.Handler
+	users     *Htpasswd
+	challenge string
+}
+
+func (bf basicAuthFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		bf.deny(w, r, "missing_credentials", "credentials missing")
+		return
+	}
+	if !bf.users.Verify(user, password) {
+		bf.deny(w, r, "invalid_credentials", fmt.Sprintf("invalid credentials for user %q", user))
+		return
+	}
+	bf.next.ServeHTTP(w, withIdentity(r, basicAuthUserKey, user, Principal{Subject: user, Method: "basic"}))
+}
+
+func (bf basicAuthFilter) deny(w http.ResponseWriter, r *http.Request, code string, reason string) {
+	w.Header().Set("WWW-Authenticate", bf.challenge)
+	WriteError(w, r, &DeniedError{Status: 401, Filter: "basicauth", Code: code, Reason: reason})
+}
+
+//BasicAuthUserFromContext returns the user authenticated by BasicAuthFilter
+func BasicAuthUserFromContext(ctx context.Context) (string, bool) {
+	user, ok := ctx.Value(basicAuthUserKey).(string)
+	return user, ok
+}
+
+//BasicAuthFilter permits requests with the credentials of one of the users using HTTP Basic authentication.
+//Other requests are answered with status 401 and a challenge for the realm, so that browsers ask for credentials.
+//  users, err := middleware.LoadHtpasswd("/etc/service/htpasswd")
+//  requireLogin := middleware.BasicAuthFilter(middleware.BasicAuthParams{Realm: "Admin", Users: users})
+//  handler := func(w http.ResponseWriter, r *http.Request) {
+//  	user, _ := middleware.BasicAuthUserFromContext(r.Context())
+//  	fmt.Fprintf(w, "Hi %s!", user)
+//  }
+//It panics if Users is nil.
+func BasicAuthFilter(params BasicAuthParams) func(http.Handler) http.Handler {
+	if params.Users == nil {
+		panic("Failed to create basic auth filter: no users")
+	}
+	realm := params.Realm
+	if realm == "" {
+		realm = "Restricted"
+	}
+	realm = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(realm)
+	challenge := fmt.Sprintf(`Basic realm="%s", charset="UTF-8"`, realm)
+	fn := func(next http.Handler) http.Handler {
+		return basicAuthFilter{next, params.Users, challenge}
+	}
+	return fn
+}
@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testHtpasswd = `# test users
+alice:$2y$04$abcdefghijklmnopqrstuujydOTSfIH/d5oUHpsygqV5X9xJLQc6e
+
+bob:$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5
+carol:$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1
+erin:$2a$04$e/1NqevxXJT1R1mwzvl6AecfoyW9UjEMzQBU/s.b5gWTF5IrjzDzq
+`
+
+func TestBasicAuthFilter(t *testing.T) {
+	users, err := LoadHtpasswd(writeTestFile(t, "htpasswd", testHtpasswd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		want     int
+	}{
+		{"bcrypt", "alice", "correct horse", 200},
+		{"bcrypt 2a", "erin", "Hello world!", 200},
+		{"SHA-256-crypt", "bob", "Hello world!", 200},
+		{"SHA-512-crypt", "carol", "Hello world!", 200},
+		{"wrong password", "alice", "Hello world!", 401},
+		{"unknown user", "mallory", "correct horse", 401},
+		{"no credentials", "", "", 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var user string
+			handler := BasicAuthFilter(BasicAuthParams{Realm: `Admin "area"`, Users: users})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				user, _ = BasicAuthUserFromContext(r.Context())
+			}))
+			request := httptest.NewRequest("GET", "/", nil)
+			if tt.user != "" {
+				request.SetBasicAuth(tt.user, tt.password)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != tt.want {
+				t.Errorf("BasicAuthFilter() status = %d, want %d", recorder.Code, tt.want)
+			}
+			challenge := recorder.Header().Get("WWW-Authenticate")
+			if tt.want == 401 && challenge != `Basic realm="Admin \"area\"", charset="UTF-8"` {
+				t.Errorf("BasicAuthFilter() challenge = %s", challenge)
+			}
+			if tt.want == 200 && user != tt.user {
+				t.Errorf("BasicAuthUserFromContext() = %s, want %s", user, tt.user)
+			}
+		})
+	}
+}
+
+func Test_newBcryptVerifier(t *testing.T) {
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		want     bool
+		wantErr  bool
+	}{
+		{"2a", "$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW", "U*U", true, false},
+		{"2a wrong password", "$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW", "U*U*", false, false},
+		{"2b empty password", "$2b$05$CCCCCCCCCCCCCCCCCCCCC.7uG0VCzI2bS7j6ymqJi9CdcdxiRTWNy", "", true, false},
+		{"2y", "$2y$04$abcdefghijklmnopqrstuujydOTSfIH/d5oUHpsygqV5X9xJLQc6e", "correct horse", true, false},
+		{"unsupported version", "$2x$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW", "", false, true},
+		{"invalid cost", "$2a$99$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW", "", false, true},
+		{"truncated", "$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJ", "", false, true},
+		{"dummy hash", htpasswdDummyHash, "guess", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verify, err := newBcryptVerifier(tt.hash)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newBcryptVerifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && verify(tt.password) != tt.want {
+				t.Errorf("verify(%q) = %v, want %v", tt.password, !tt.want, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadHtpasswd_invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"missing hash", "alice\n"},
+		{"MD5", "alice:$apr1$salt$hash\n"},
+		{"plaintext", "alice:secret\n"},
+		{"invalid bcrypt", "alice:$2y$04$short\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadHtpasswd(writeTestFile(t, "htpasswd", tt.content)); err == nil {
+				t.Errorf("LoadHtpasswd() expected error")
+			}
+		})
+	}
+}
+
+func TestHtpasswd_Watch(t *testing.T) {
+	path := writeTestFile(t, "htpasswd", testHtpasswd)
+	users, err := LoadHtpasswd(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := users.Watch(path, 10*time.Millisecond)
+	defer stop()
+
+	replace := func(content string) {
+		temporary := filepath.Join(filepath.Dir(path), "htpasswd.tmp")
+		if err := os.WriteFile(temporary, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(temporary, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	eventually := func(condition func() bool) bool {
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if condition() {
+				return true
+			}
+		}
+		return false
+	}
+
+	replace("dave:$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5\n")
+	if !eventually(func() bool { return users.Verify("dave", "Hello world!") }) {
+		t.Fatalf("Watch() did not reload the changed file")
+	}
+	if users.Verify("alice", "correct horse") {
+		t.Errorf("Watch() kept removed user")
+	}
+
+	replace("invalid\n")
+	time.Sleep(50 * time.Millisecond)
+	if !users.Verify("dave", "Hello world!") {
+		t.Errorf("Watch() replaced users with invalid file")
+	}
+}
+
+func TestBasicAuthFilter_escapesUser(t *testing.T) {
+	users, err := LoadHtpasswd(writeTestFile(t, "htpasswd", testHtpasswd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reason string
+	errs := HandleErrors(ErrorParams{Log: func(r *http.Request, status int, err error) {
+		reason = err.Error()
+	}})
+	handler := errs(BasicAuthFilter(BasicAuthParams{Users: users})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	request := httptest.NewRequest("GET", "/", nil)
+	request.SetBasicAuth("mallory\n2021/01/01 00:00:00 forged line", "guess")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	if strings.Contains(reason, "\n") {
+		t.Errorf("BasicAuthFilter() logged unescaped user: %q", reason)
+	}
+}
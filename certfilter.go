@@ -0,0 +1,313 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//ClientCertParams configures ClientCertFilter.
+//A client certificate is accepted if it matches any of CommonNames, DNSNames, URIs or Fingerprints
+//(or all of them are empty) and, if Issuers is not empty, one of the Issuers. DNSNames may start with "*."
+//to match a single label, URIs may end with "*" to match a prefix, e.g. "spiffe://example.org/ns/prod/*".
+//Issuers are compared to the common name and the distinguished name of the issuer, e.g. "CN=Internal CA,O=Example".
+//Fingerprints are hex encoded SHA-256 hashes of the certificate, optionally separated by colons.
+//The certificate must have been verified by the TLS server (tls.Config.ClientAuth RequireAndVerifyClientCert
+//or VerifyClientCertIfGiven), unless it matches one of the pinned Fingerprints.
+//Certificates revoked by one of the certificate revocation lists in CRLFiles (PEM or DER) are rejected.
+//Instead of CRLFiles, RevocationLists may be set to lists that are replaced while the filter is in use,
+//e.g. by RevocationLists.Watch. Revocation lists are only trusted if they are signed by the issuer in the verified
+//chain of the certificate. Once the NextUpdate of the list of its issuer has passed, certificates are rejected.
+type ClientCertParams struct {
+	CommonNames     []string
+	DNSNames        []string
+	URIs            []string
+	Issuers         []string
+	Fingerprints    []string
+	CRLFiles        []string
+	RevocationLists *RevocationLists
+}
+
+//ClientCertIdentity describes the client certificate accepted by ClientCertFilter
+type ClientCertIdentity struct {
+	CommonName  string
+	DNSNames    []string
+	URIs        []string
+	SPIFFEID    string //first URI SAN with scheme spiffe, if any
+	Issuer      string
+	Fingerprint string //hex encoded SHA-256 hash of the certificate
+	Certificate *x509.Certificate
+}
+
+type clientCertFilter struct {
+	next         http.Handler
+	params       ClientCertParams
+	fingerprints map[string]bool
+	revocations  *RevocationLists
+}
+
+func (cf clientCertFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	identity, err := cf.verify(r)
+	if err != nil {
+		WriteError(w, r, &DeniedError{Status: 403, Filter: "clientcert", Code: "invalid_certificate", Reason: fmt.Sprintf("client certificate verification failed: %v", err)})
+		return
+	}
+	cf.next.ServeHTTP(w, withIdentity(r, clientCertKey, identity, clientCertPrincipal(identity)))
+}
+
+func (cf clientCertFilter) verify(r *http.Request) (ClientCertIdentity, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ClientCertIdentity{}, fmt.Errorf("no client certificate")
+	}
+	certificate := r.TLS.PeerCertificates[0]
+	identity := newClientCertIdentity(certificate)
+
+	pinned := cf.fingerprints[identity.Fingerprint]
+	if !pinned && len(r.TLS.VerifiedChains) == 0 {
+		return identity, fmt.Errorf("certificate of %s was not verified", identity.CommonName)
+	}
+	if len(cf.params.Issuers) > 0 && !containsFold(cf.params.Issuers, certificate.Issuer.CommonName) &&
+		!containsFold(cf.params.Issuers, certificate.Issuer.String()) {
+		return identity, fmt.Errorf("issuer %s not permitted", certificate.Issuer)
+	}
+	if !pinned && !cf.matchesName(certificate) {
+		return identity, fmt.Errorf("certificate of %s not permitted", identity.CommonName)
+	}
+	if cf.revocations != nil {
+		var issuer *x509.Certificate
+		if len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 1 {
+			issuer = r.TLS.VerifiedChains[0][1]
+		}
+		if err := cf.revocations.check(certificate, issuer, time.Now()); err != nil {
+			return identity, err
+		}
+	}
+	return identity, nil
+}
+
+func (cf clientCertFilter) matchesName(certificate *x509.Certificate) bool {
+	params := cf.params
+	if len(params.CommonNames) == 0 && len(params.DNSNames) == 0 && len(params.URIs) == 0 && len(params.Fingerprints) == 0 {
+		return true
+	}
+	for _, commonName := range params.CommonNames {
+		if commonName == certificate.Subject.CommonName {
+			return true
+		}
+	}
+	for _, pattern := range params.DNSNames {
+		for _, dnsName := range certificate.DNSNames {
+			if matchDNSName(pattern, dnsName) {
+				return true
+			}
+		}
+	}
+	for _, pattern := range params.URIs {
+		for _, uri := range certificate.URIs {
+			if matchURI(pattern, uri.String()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchDNSName(pattern string, name string) bool {
+	pattern, name = strings.ToLower(pattern), strings.ToLower(strings.TrimSuffix(name, "."))
+	if strings.HasPrefix(pattern, "*.") {
+		dot := strings.Index(name, ".")
+		return dot > 0 && name[dot:] == pattern[1:]
+	}
+	return pattern == name
+}
+
+func matchURI(pattern string, uri string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(uri, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == uri
+}
+
+func newClientCertIdentity(certificate *x509.Certificate) ClientCertIdentity {
+	fingerprint := sha256.Sum256(certificate.Raw)
+	identity := ClientCertIdentity{
+		CommonName:  certificate.Subject.CommonName,
+		DNSNames:    certificate.DNSNames,
+		Issuer:      certificate.Issuer.String(),
+		Fingerprint: hex.EncodeToString(fingerprint[:]),
+		Certificate: certificate,
+	}
+	for _, uri := range certificate.URIs {
+		identity.URIs = append(identity.URIs, uri.String())
+		if identity.SPIFFEID == "" && uri.Scheme == "spiffe" {
+			identity.SPIFFEID = uri.String()
+		}
+	}
+	return identity
+}
+
+//ClientCertFromContext returns the identity of the client certificate accepted by ClientCertFilter
+func ClientCertFromContext(ctx context.Context) (ClientCertIdentity, bool) {
+	identity, ok := ctx.Value(clientCertKey).(ClientCertIdentity)
+	return identity, ok
+}
+
+//ClientCertFilter permits requests with a TLS client certificate that matches params.
+//The identity of the certificate is available to the following handlers with ClientCertFromContext:
+//  internalOnly := middleware.ClientCertFilter(middleware.ClientCertParams{
+//  	URIs:     []string{"spiffe://example.org/ns/prod/*"},
+//  	CRLFiles: []string{"/etc/pki/internal.crl"},
+//  })
+//  handler := func(w http.ResponseWriter, r *http.Request) {
+//  	identity, _ := middleware.ClientCertFromContext(r.Context())
+//  	fmt.Fprintf(w, "Hi %s!", identity.SPIFFEID)
+//  }
+func ClientCertFilter(params ClientCertParams) func(http.Handler) http.Handler {
+	fingerprints := make(map[string]bool)
+	for _, fingerprint := range params.Fingerprints {
+		fingerprint = strings.ToLower(strings.NewReplacer(":", "", " ", "").Replace(fingerprint))
+		fingerprints[fingerprint] = true
+	}
+	revocations := params.RevocationLists
+	if revocations == nil && len(params.CRLFiles) > 0 {
+		var err error
+		revocations, err = LoadRevocationLists(params.CRLFiles...)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to load certificate revocation list %s", err))
+		}
+	}
+	fn := func(next http.Handler) http.Handler {
+		return clientCertFilter{next, params, fingerprints, revocations}
+	}
+	return fn
+}
+
+//RevocationLists is a set of certificate revocation lists that can be replaced atomically while it is used by
+//a ClientCertFilter, e.g. to reload them when the CA publishes new lists.
+type RevocationLists struct {
+	state atomic.Value // *revocationState
+}
+
+type revocationState struct {
+	lists []*x509.RevocationList
+	//verified caches the result of checking the signature of a list, by list and issuer
+	verified sync.Map
+}
+
+type revocationCheck struct {
+	list   *x509.RevocationList
+	issuer string
+}
+
+//LoadRevocationLists reads certificate revocation lists from PEM or DER files
+func LoadRevocationLists(paths ...string) (*RevocationLists, error) {
+	lists := &RevocationLists{}
+	if err := lists.ReplaceFromFiles(paths...); err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+//ReplaceFromFiles atomically swaps the revocation lists with the ones read from the files at paths.
+//If any of the files cannot be read or is invalid, the lists are left unchanged.
+func (l *RevocationLists) ReplaceFromFiles(paths ...string) error {
+	var lists []*x509.RevocationList
+	for _, path := range paths {
+		crl, err := loadCRL(path)
+		if err != nil {
+			return err
+		}
+		lists = append(lists, crl)
+	}
+	l.state.Store(&revocationState{lists: lists})
+	return nil
+}
+
+//Watch checks the files at paths for modifications every interval and reloads all lists whenever one of them
+//has changed. If a changed file is invalid, the previous lists are kept and an error is logged.
+//Watching stops when the returned function is called. An interval of zero or less defaults to 10 seconds.
+//  crls, err := middleware.LoadRevocationLists("/etc/pki/internal.crl")
+//  stop := crls.Watch([]string{"/etc/pki/internal.crl"}, time.Minute)
+//  defer stop()
+//  internalOnly := middleware.ClientCertFilter(middleware.ClientCertParams{RevocationLists: crls})
+func (l *RevocationLists) Watch(paths []string, interval time.Duration) (stop func()) {
+	var stops []func()
+	for _, path := range paths {
+		stops = append(stops, watchFile(path, interval, func() {
+			if err := l.ReplaceFromFiles(paths...); err != nil {
+				log.Printf("Failed to reload certificate revocation lists, keeping previous lists: %v \n", err)
+			}
+		}))
+	}
+	return func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+}
+
+//check returns an error if certificate is revoked by one of the lists of its issuer, or if such a list
+//cannot be trusted because it is not signed by issuer or has expired
+func (l *RevocationLists) check(certificate *x509.Certificate, issuer *x509.Certificate, now time.Time) error {
+	state, _ := l.state.Load().(*revocationState)
+	if state == nil {
+		return nil
+	}
+	for _, crl := range state.lists {
+		if !bytes.Equal(crl.RawIssuer, certificate.RawIssuer) {
+			continue
+		}
+		if err := state.verify(crl, issuer); err != nil {
+			return fmt.Errorf("revocation list of %s cannot be trusted: %w", certificate.Issuer, err)
+		}
+		if !crl.NextUpdate.IsZero() && now.After(crl.NextUpdate) {
+			return fmt.Errorf("revocation list of %s expired at %s", certificate.Issuer, crl.NextUpdate.Format(time.RFC3339))
+		}
+		for _, revoked := range crl.RevokedCertificateEntries {
+			if revoked.SerialNumber.Cmp(certificate.SerialNumber) == 0 {
+				return fmt.Errorf("certificate of %s with serial number %s is revoked", certificate.Subject.CommonName, certificate.SerialNumber)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *revocationState) verify(crl *x509.RevocationList, issuer *x509.Certificate) error {
+	if issuer == nil {
+		return fmt.Errorf("the issuer of the certificate was not verified")
+	}
+	key := revocationCheck{crl, string(issuer.Raw)}
+	if result, ok := s.verified.Load(key); ok {
+		err, _ := result.(error)
+		return err
+	}
+	err := crl.CheckSignatureFrom(issuer)
+	s.verified.Store(key, err)
+	return err
+}
+
+func loadCRL(path string) (*x509.RevocationList, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(content); block != nil {
+		content = block.Bytes
+	}
+	crl, err := x509.ParseRevocationList(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return crl, nil
+}
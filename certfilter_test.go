@@ -0,0 +1,210 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, name string) testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name, Organization: []string{"Example"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+	return testCA{certificate, key}
+}
+
+func (ca testCA) issue(t *testing.T, serial int64, commonName string, dnsNames []string, uris []string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     dnsNames,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	for _, uri := range uris {
+		parsed, _ := url.Parse(uri)
+		template.URIs = append(template.URIs, parsed)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+	return certificate
+}
+
+func (ca testCA) crl(t *testing.T, nextUpdate time.Time, serials ...int64) []byte {
+	template := &x509.RevocationList{Number: big.NewInt(1), ThisUpdate: nextUpdate.Add(-2 * time.Hour), NextUpdate: nextUpdate}
+	for _, serial := range serials {
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries,
+			x509.RevocationListEntry{SerialNumber: big.NewInt(serial), RevocationTime: time.Now()})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, template, ca.certificate, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+}
+
+func TestClientCertFilter(t *testing.T) {
+	ca := newTestCA(t, "Internal CA")
+	otherCA := newTestCA(t, "Other CA")
+	api := ca.issue(t, 10, "api", []string{"api.internal.example.org"}, []string{"spiffe://example.org/ns/prod/sa/api"})
+	revoked := ca.issue(t, 11, "revoked", nil, []string{"spiffe://example.org/ns/prod/sa/revoked"})
+	foreign := otherCA.issue(t, 10, "api", nil, nil)
+	crlFile := writeTestFile(t, "internal.crl", string(ca.crl(t, time.Now().Add(time.Hour), 11)))
+	expiredCRLFile := writeTestFile(t, "expired.crl", string(ca.crl(t, time.Now().Add(-time.Minute), 11)))
+	forgedCRLFile := writeTestFile(t, "forged.crl", string(newTestCA(t, "Internal CA").crl(t, time.Now().Add(time.Hour), 10)))
+	fingerprint := newClientCertIdentity(foreign).Fingerprint
+
+	verified := func(certificate *x509.Certificate) *tls.ConnectionState {
+		return &tls.ConnectionState{PeerCertificates: []*x509.Certificate{certificate}, VerifiedChains: [][]*x509.Certificate{{certificate, ca.certificate}}}
+	}
+	unverified := func(certificate *x509.Certificate) *tls.ConnectionState {
+		return &tls.ConnectionState{PeerCertificates: []*x509.Certificate{certificate}}
+	}
+
+	tests := []struct {
+		name   string
+		params ClientCertParams
+		tls    *tls.ConnectionState
+		want   int
+	}{
+		{"no TLS", ClientCertParams{}, nil, 403},
+		{"no client certificate", ClientCertParams{}, &tls.ConnectionState{}, 403},
+		{"any verified certificate", ClientCertParams{}, verified(api), 200},
+		{"unverified certificate", ClientCertParams{}, unverified(api), 403},
+		{"common name", ClientCertParams{CommonNames: []string{"api"}}, verified(api), 200},
+		{"wrong common name", ClientCertParams{CommonNames: []string{"web"}}, verified(api), 403},
+		{"DNS name", ClientCertParams{DNSNames: []string{"API.internal.example.org"}}, verified(api), 200},
+		{"wildcard DNS name", ClientCertParams{DNSNames: []string{"*.internal.example.org"}}, verified(api), 200},
+		{"wildcard DNS name matches single label", ClientCertParams{DNSNames: []string{"*.example.org"}}, verified(api), 403},
+		{"SPIFFE ID", ClientCertParams{URIs: []string{"spiffe://example.org/ns/prod/sa/api"}}, verified(api), 200},
+		{"SPIFFE ID prefix", ClientCertParams{URIs: []string{"spiffe://example.org/ns/prod/*"}}, verified(api), 200},
+		{"wrong SPIFFE ID prefix", ClientCertParams{URIs: []string{"spiffe://example.org/ns/dev/*"}}, verified(api), 403},
+		{"issuer common name", ClientCertParams{Issuers: []string{"Internal CA"}}, verified(api), 200},
+		{"issuer distinguished name", ClientCertParams{Issuers: []string{"CN=Internal CA,O=Example"}}, verified(api), 200},
+		{"wrong issuer", ClientCertParams{Issuers: []string{"Other CA"}, CommonNames: []string{"api"}}, verified(api), 403},
+		{"pinned unverified certificate", ClientCertParams{Fingerprints: []string{fingerprint}}, unverified(foreign), 200},
+		{"pinned certificate mismatch", ClientCertParams{Fingerprints: []string{fingerprint}}, verified(api), 403},
+		{"revoked certificate", ClientCertParams{CRLFiles: []string{crlFile}}, verified(revoked), 403},
+		{"certificate not revoked", ClientCertParams{CRLFiles: []string{crlFile}}, verified(api), 200},
+		{"same serial from other issuer", ClientCertParams{CRLFiles: []string{crlFile}}, verified(otherCA.issue(t, 11, "other", nil, nil)), 200},
+		{"expired CRL", ClientCertParams{CRLFiles: []string{expiredCRLFile}}, verified(api), 403},
+		{"CRL not signed by issuer", ClientCertParams{CRLFiles: []string{forgedCRLFile}}, verified(api), 403},
+		{"CRL of unverified issuer", ClientCertParams{CRLFiles: []string{crlFile}, Fingerprints: []string{newClientCertIdentity(api).Fingerprint}}, unverified(api), 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var identity ClientCertIdentity
+			handler := ClientCertFilter(tt.params)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				identity, _ = ClientCertFromContext(r.Context())
+			}))
+			request := httptest.NewRequest("GET", "/", nil)
+			request.TLS = tt.tls
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != tt.want {
+				t.Errorf("ClientCertFilter() status = %d, want %d", recorder.Code, tt.want)
+			}
+			if recorder.Code == 200 && identity.Certificate != tt.tls.PeerCertificates[0] {
+				t.Errorf("ClientCertFromContext() identity = %v", identity)
+			}
+		})
+	}
+}
+
+func Test_newClientCertIdentity(t *testing.T) {
+	ca := newTestCA(t, "Internal CA")
+	certificate := ca.issue(t, 10, "api", []string{"api.example.org"}, []string{"https://example.org/api", "spiffe://example.org/api"})
+	identity := newClientCertIdentity(certificate)
+	if identity.CommonName != "api" || identity.SPIFFEID != "spiffe://example.org/api" || len(identity.URIs) != 2 ||
+		identity.Issuer != "CN=Internal CA,O=Example" || len(identity.Fingerprint) != 64 {
+		t.Errorf("newClientCertIdentity() = %+v", identity)
+	}
+}
+
+func TestClientCertFilter_invalidCRL(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("ClientCertFilter() with invalid CRL should panic")
+		}
+	}()
+	ClientCertFilter(ClientCertParams{CRLFiles: []string{writeTestFile(t, "invalid.crl", "not a crl")}})
+}
+
+func TestRevocationLists_Watch(t *testing.T) {
+	ca := newTestCA(t, "Internal CA")
+	api := ca.issue(t, 10, "api", nil, nil)
+	path := writeTestFile(t, "internal.crl", string(ca.crl(t, time.Now().Add(time.Hour))))
+	crls, err := LoadRevocationLists(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := crls.Watch([]string{path}, 5*time.Millisecond)
+	defer stop()
+
+	handler := ClientCertFilter(ClientCertParams{RevocationLists: crls})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	send := func() int {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{api}, VerifiedChains: [][]*x509.Certificate{{api, ca.certificate}}}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+	if got := send(); got != 200 {
+		t.Fatalf("ClientCertFilter() status = %d, want 200", got)
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, ca.crl(t, time.Now().Add(2*time.Hour), 10), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for send() != 403 {
+		if time.Now().After(deadline) {
+			t.Fatalf("ClientCertFilter() should reject certificate after it was revoked in the reloaded list")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+//Entry is a middleware with a name, which identifies it in the String representation of a Chain
+//and in the ordering constraints of other entries.
+//Before and After name the entries the middleware must run before or after, if they are part of the chain.
+//Once forbids other entries with the same name in the chain. The constraints are enforced by Chain.Sort and AssembleEntries:
+//  auth := middleware.Entry{Name: "auth", Middleware: requireToken, Once: true}
+//  limit := middleware.Entry{Name: "ratelimit", Middleware: rateLimit, After: []string{"auth"}}
+type Entry struct {
+	Name       string
+	Middleware Middleware
+	Before     []string
+	After      []string
+	Once       bool
+}
+
+//Named creates an entry for a chain:
+//  middleware.Named("hmac", middleware.HmacFilter(params))
+func Named(name string, m Middleware) Entry {
+	return Entry{Name: name, Middleware: m}
+}
+
+//String returns the name of the entry. Entries without a name are named after the function
+//that created the middleware, e.g. "middleware.HmacFilter".
+func (e Entry) String() string {
+	if e.Name != "" {
+		return e.Name
+	}
+	if e.Middleware == nil {
+		return "<nil>"
+	}
+	name := runtime.FuncForPC(reflect.ValueOf(e.Middleware).Pointer()).Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	name = strings.TrimSuffix(name, "-fm")
+	for {
+		// closures are named after the enclosing function with a suffix like .func1
+		i := strings.LastIndex(name, ".func")
+		if i < 0 || strings.Trim(name[i+len(".func"):], "0123456789.") != "" {
+			return name
+		}
+		name = name[:i]
+	}
+}
+
+//Chain is a sequence of named middlewares. Unlike a Middleware assembled with Append or Assemble, a chain
+//can list its entries, e.g. to verify that all filters are in place:
+//  chain := middleware.NewChain(
+//  	middleware.Named("cors", cors),
+//  	middleware.Named("hmac", hmac),
+//  )
+//  fmt.Println(chain) // cors -> hmac
+//  mux.Handle("/hooks", chain.Then(handler))
+//Chains are immutable, Append and Prepend return a new chain.
+type Chain struct {
+	entries []Entry
+}
+
+//NewChain creates a chain of the entries, the first entry is the outermost middleware
+func NewChain(entries ...Entry) Chain {
+	return Chain{}.Append(entries...)
+}
+
+//Append returns a chain with the entries added to the end
+func (c Chain) Append(entries ...Entry) Chain {
+	c.entries = append(c.entries[:len(c.entries):len(c.entries)], entries...)
+	return c
+}
+
+//Prepend returns a chain with the entries added to the beginning
+func (c Chain) Prepend(entries ...Entry) Chain {
+	c.entries = append(append([]Entry(nil), entries...), c.entries...)
+	return c
+}
+
+//Entries returns the entries of the chain, the first entry is the outermost middleware
+func (c Chain) Entries() []Entry {
+	return append([]Entry(nil), c.entries...)
+}
+
+//Sort returns a chain in which the entries satisfy their ordering constraints. Entries that are not
+//constrained keep their relative order. It returns an error if the constraints contradict each other
+//or if an entry that may be used only once appears more than once:
+//  chain, err := middleware.NewChain(limit, auth).Sort() // auth -> ratelimit
+func (c Chain) Sort() (Chain, error) {
+	names := make([]string, len(c.entries))
+	count := make(map[string]int)
+	for i, entry := range c.entries {
+		names[i] = entry.String()
+		count[names[i]]++
+	}
+	for i, entry := range c.entries {
+		if entry.Once && count[names[i]] > 1 {
+			return c, fmt.Errorf("%s must be used only once, but appears %d times", names[i], count[names[i]])
+		}
+	}
+
+	// successors[i] are the entries that must run after entry i
+	successors := make([][]int, len(c.entries))
+	predecessors := make([]int, len(c.entries))
+	for i, entry := range c.entries {
+		for j := range c.entries {
+			if i != j && (contains(entry.Before, names[j]) || contains(c.entries[j].After, names[i])) {
+				successors[i] = append(successors[i], j)
+				predecessors[j]++
+			}
+		}
+	}
+	sorted := make([]Entry, 0, len(c.entries))
+	done := make([]bool, len(c.entries))
+	for len(sorted) < len(c.entries) {
+		next := -1
+		for i := range c.entries {
+			if !done[i] && predecessors[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			var cycle []string
+			for i := range c.entries {
+				if !done[i] {
+					cycle = append(cycle, names[i])
+				}
+			}
+			return c, fmt.Errorf("contradicting ordering constraints between %s", strings.Join(cycle, ", "))
+		}
+		done[next] = true
+		sorted = append(sorted, c.entries[next])
+		for _, j := range successors[next] {
+			predecessors[j]--
+		}
+	}
+	return Chain{entries: sorted}, nil
+}
+
+//String returns the names of the entries in order, e.g. "cors -> hmac"
+func (c Chain) String() string {
+	names := make([]string, len(c.entries))
+	for i, entry := range c.entries {
+		names[i] = entry.String()
+	}
+	return strings.Join(names, " -> ")
+}
+
+//Middleware assembles the entries into a single middleware
+func (c Chain) Middleware() Middleware {
+	assembly := New()
+	for _, entry := range c.entries {
+		assembly = assembly.Append(entry.Middleware)
+	}
+	return assembly
+}
+
+//Then applies the chain to the handler
+func (c Chain) Then(handler http.Handler) http.Handler {
+	return c.Middleware()(handler)
+}
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	var calls []string
+	record := func(name string) Entry {
+		return Named(name, func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		})
+	}
+	base := NewChain(record("b"), record("c"))
+	appended := base.Append(record("d"))
+	prepended := base.Prepend(record("a"))
+	tests := []struct {
+		name  string
+		chain Chain
+		want  string
+	}{
+		{"empty", NewChain(), ""},
+		{"base", base, "b -> c"},
+		{"append", appended, "b -> c -> d"},
+		{"prepend", prepended, "a -> b -> c"},
+		{"append does not modify other chains", base.Append(record("e")), "b -> c -> e"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.chain.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+			calls = nil
+			tt.chain.Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+			if got := strings.Join(calls, " -> "); got != tt.want {
+				t.Errorf("Then() called %q, want %q", got, tt.want)
+			}
+			if got := len(tt.chain.Entries()); got != len(calls) {
+				t.Errorf("Entries() has %d entries, want %d", got, len(calls))
+			}
+		})
+	}
+}
+
+func TestEntry_String(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry Entry
+		want  string
+	}{
+		{"explicit name", Named("hmac", HmacFilter(HmacParams{Secret: "secret"})), "hmac"},
+		{"filter", Entry{Middleware: HmacFilter(HmacParams{Secret: "secret"})}, "middleware.HmacFilter"},
+		{"function", Entry{Middleware: Middleware(New())}, "middleware.New"},
+		{"method", Entry{Middleware: New().When(Method("GET"))}, "middleware.Middleware.When"},
+		{"nil", Entry{}, "<nil>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.entry.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChain_Sort(t *testing.T) {
+	entry := func(name string, before []string, after []string, once bool) Entry {
+		return Entry{Name: name, Middleware: New(), Before: before, After: after, Once: once}
+	}
+	tests := []struct {
+		name    string
+		entries []Entry
+		want    string
+		wantErr bool
+	}{
+		{"no constraints", []Entry{entry("a", nil, nil, false), entry("b", nil, nil, false)}, "a -> b", false},
+		{"after", []Entry{entry("ratelimit", nil, []string{"auth"}, false), entry("auth", nil, nil, false), entry("log", nil, nil, false)},
+			"auth -> ratelimit -> log", false},
+		{"before", []Entry{entry("compress", nil, nil, false), entry("hmac", []string{"compress"}, nil, false)}, "hmac -> compress", false},
+		{"missing entries are ignored", []Entry{entry("a", []string{"x"}, []string{"y"}, false), entry("b", nil, nil, false)}, "a -> b", false},
+		{"constraints apply to all entries with the name", []Entry{entry("log", nil, nil, false), entry("auth", []string{"log"}, nil, false),
+			entry("log", nil, nil, false)}, "auth -> log -> log", false},
+		{"transitive", []Entry{entry("c", nil, []string{"b"}, false), entry("b", nil, []string{"a"}, false), entry("a", nil, nil, false)},
+			"a -> b -> c", false},
+		{"duplicate of entry used once", []Entry{entry("auth", nil, nil, true), entry("log", nil, nil, false), entry("auth", nil, nil, false)}, "", true},
+		{"cycle", []Entry{entry("a", []string{"b"}, nil, false), entry("b", []string{"a"}, nil, false)}, "", true},
+		{"contradiction", []Entry{entry("a", []string{"b"}, nil, false), entry("b", nil, nil, false), entry("c", []string{"a"}, []string{"b"}, false)},
+			"", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain, err := NewChain(tt.entries...).Sort()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Sort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && chain.String() != tt.want {
+				t.Errorf("Sort() = %q, want %q", chain.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestAssembleEntries(t *testing.T) {
+	var calls []string
+	record := func(name string, after []string, once bool) Entry {
+		return Entry{Name: name, After: after, Once: once, Middleware: func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}}
+	}
+	tests := []struct {
+		name    string
+		entries []Entry
+		want    string
+		wantErr bool
+	}{
+		{"sorted", []Entry{record("ratelimit", []string{"auth"}, false), record("auth", nil, true)}, "auth -> ratelimit", false},
+		{"duplicate", []Entry{record("auth", nil, true), record("auth", nil, false)}, "", true},
+		{"cycle", []Entry{record("a", []string{"b"}, false), record("b", []string{"a"}, false)}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			middlewares, err := AssembleEntries(tt.entries...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AssembleEntries() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			calls = nil
+			middlewares.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+			if got := strings.Join(calls, " -> "); got != tt.want {
+				t.Errorf("AssembleEntries() called %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+//IPRangeSelector selects entries from the ip range documents published by cloud providers.
+//Services and Regions are compared case-insensitively, an empty list matches every entry:
+//  cloudFront := middleware.IPRangeSelector{Services: []string{"CLOUDFRONT"}}
+//  ipRanges, err := middleware.LoadAWSIPRanges("ip-ranges.json", cloudFront)
+//  filter := middleware.IPFilter(ipRanges, "")
+type IPRangeSelector struct {
+	Services []string
+	Regions  []string
+}
+
+func (s IPRangeSelector) matches(service string, region string) bool {
+	return (len(s.Services) == 0 || containsFold(s.Services, service)) && (len(s.Regions) == 0 || containsFold(s.Regions, region))
+}
+
+//LoadAWSIPRanges reads the IPv4 and IPv6 prefixes from a copy of https://ip-ranges.amazonaws.com/ip-ranges.json.
+//Services are matched against the service field (e.g. "CLOUDFRONT", "EC2") and regions against the region field
+//(e.g. "eu-central-1", "GLOBAL").
+func LoadAWSIPRanges(path string, selector IPRangeSelector) ([]string, error) {
+	var document struct {
+		Prefixes []struct {
+			IPPrefix string `json:"ip_prefix"`
+			Region   string `json:"region"`
+			Service  string `json:"service"`
+		} `json:"prefixes"`
+		IPv6Prefixes []struct {
+			IPv6Prefix string `json:"ipv6_prefix"`
+			Region     string `json:"region"`
+			Service    string `json:"service"`
+		} `json:"ipv6_prefixes"`
+	}
+	if err := readJSON(path, &document); err != nil {
+		return nil, err
+	}
+
+	var ipRanges []string
+	for _, prefix := range document.Prefixes {
+		if selector.matches(prefix.Service, prefix.Region) {
+			ipRanges = append(ipRanges, prefix.IPPrefix)
+		}
+	}
+	for _, prefix := range document.IPv6Prefixes {
+		if selector.matches(prefix.Service, prefix.Region) {
+			ipRanges = append(ipRanges, prefix.IPv6Prefix)
+		}
+	}
+	return uniqueRanges(ipRanges), nil
+}
+
+//LoadGCPIPRanges reads the IPv4 and IPv6 prefixes from a copy of https://www.gstatic.com/ipranges/cloud.json.
+//Services are matched against the service field (e.g. "Google Cloud") and regions against the scope field
+//(e.g. "europe-west3").
+func LoadGCPIPRanges(path string, selector IPRangeSelector) ([]string, error) {
+	var document struct {
+		Prefixes []struct {
+			IPv4Prefix string `json:"ipv4Prefix"`
+			IPv6Prefix string `json:"ipv6Prefix"`
+			Service    string `json:"service"`
+			Scope      string `json:"scope"`
+		} `json:"prefixes"`
+	}
+	if err := readJSON(path, &document); err != nil {
+		return nil, err
+	}
+
+	var ipRanges []string
+	for _, prefix := range document.Prefixes {
+		if !selector.matches(prefix.Service, prefix.Scope) {
+			continue
+		}
+		if prefix.IPv4Prefix != "" {
+			ipRanges = append(ipRanges, prefix.IPv4Prefix)
+		}
+		if prefix.IPv6Prefix != "" {
+			ipRanges = append(ipRanges, prefix.IPv6Prefix)
+		}
+	}
+	return uniqueRanges(ipRanges), nil
+}
+
+//LoadAzureServiceTags reads the address prefixes from a copy of the Azure Service Tags JSON file
+//(ServiceTags_Public_*.json). Services are matched against the name of a tag (e.g. "AzureFrontDoor.Backend")
+//as well as its system service (e.g. "AzureFrontDoor"), regions against the region of a tag (e.g. "westeurope").
+//Tags that are not bound to a region have an empty region, which is matched by selecting the region "".
+func LoadAzureServiceTags(path string, selector IPRangeSelector) ([]string, error) {
+	var document struct {
+		Values []struct {
+			Name       string `json:"name"`
+			Properties struct {
+				Region          string   `json:"region"`
+				SystemService   string   `json:"systemService"`
+				AddressPrefixes []string `json:"addressPrefixes"`
+			} `json:"properties"`
+		} `json:"values"`
+	}
+	if err := readJSON(path, &document); err != nil {
+		return nil, err
+	}
+
+	var ipRanges []string
+	for _, tag := range document.Values {
+		properties := tag.Properties
+		if selector.matches(tag.Name, properties.Region) || selector.matches(properties.SystemService, properties.Region) {
+			ipRanges = append(ipRanges, properties.AddressPrefixes...)
+		}
+	}
+	return uniqueRanges(ipRanges), nil
+}
+
+//LoadGitHubMeta reads ip ranges from a copy of https://api.github.com/meta. Lists selects the lists of ranges
+//to read (e.g. "hooks", "actions", "web"). If no list is given, only the ranges of webhook senders ("hooks") are read.
+func LoadGitHubMeta(path string, lists ...string) ([]string, error) {
+	if len(lists) == 0 {
+		lists = []string{"hooks"}
+	}
+	var document map[string]json.RawMessage
+	if err := readJSON(path, &document); err != nil {
+		return nil, err
+	}
+
+	var ipRanges []string
+	for _, list := range lists {
+		raw, ok := document[list]
+		if !ok {
+			return nil, fmt.Errorf("list %s not found in %s", list, path)
+		}
+		var listRanges []string
+		if err := json.Unmarshal(raw, &listRanges); err != nil {
+			return nil, fmt.Errorf("invalid list %s in %s: %w", list, path, err)
+		}
+		ipRanges = append(ipRanges, listRanges...)
+	}
+	return uniqueRanges(ipRanges), nil
+}
+
+//LoadCloudflareIPs reads ip ranges from copies of https://www.cloudflare.com/ips-v4 and
+//https://www.cloudflare.com/ips-v6, which contain one range per line.
+func LoadCloudflareIPs(paths ...string) ([]string, error) {
+	var ipRanges []string
+	for _, path := range paths {
+		fileRanges, err := readIPRanges(path)
+		if err != nil {
+			return nil, err
+		}
+		ipRanges = append(ipRanges, fileRanges...)
+	}
+	return uniqueRanges(ipRanges), nil
+}
+
+func readJSON(path string, v interface{}) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("invalid ip range document %s: %w", path, err)
+	}
+	return nil
+}
+
+func uniqueRanges(ipRanges []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, ipRange := range ipRanges {
+		if !seen[ipRange] {
+			seen[ipRange] = true
+			unique = append(unique, ipRange)
+		}
+	}
+	return unique
+}
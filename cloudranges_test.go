@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const awsIPRanges = `{
+  "syncToken": "1600000000",
+  "createDate": "2020-09-13-12-00-00",
+  "prefixes": [
+    {"ip_prefix": "3.5.140.0/22", "region": "ap-northeast-2", "service": "AMAZON", "network_border_group": "ap-northeast-2"},
+    {"ip_prefix": "13.32.0.0/15", "region": "GLOBAL", "service": "CLOUDFRONT", "network_border_group": "GLOBAL"},
+    {"ip_prefix": "13.32.0.0/15", "region": "GLOBAL", "service": "AMAZON", "network_border_group": "GLOBAL"},
+    {"ip_prefix": "18.184.0.0/15", "region": "eu-central-1", "service": "EC2", "network_border_group": "eu-central-1"}
+  ],
+  "ipv6_prefixes": [
+    {"ipv6_prefix": "2600:9000:2000::/36", "region": "GLOBAL", "service": "CLOUDFRONT", "network_border_group": "GLOBAL"},
+    {"ipv6_prefix": "2a05:d050:4000::/40", "region": "eu-central-1", "service": "EC2", "network_border_group": "eu-central-1"}
+  ]
+}`
+
+const gcpIPRanges = `{
+  "syncToken": "1600000000000",
+  "creationTime": "2020-09-13T12:00:00.000000",
+  "prefixes": [
+    {"ipv4Prefix": "34.35.0.0/16", "service": "Google Cloud", "scope": "africa-south1"},
+    {"ipv6Prefix": "2600:1900:8000::/44", "service": "Google Cloud", "scope": "europe-west3"},
+    {"ipv4Prefix": "34.89.0.0/17", "service": "Google Cloud", "scope": "europe-west3"}
+  ]
+}`
+
+const azureServiceTags = `{
+  "changeNumber": 100,
+  "cloud": "Public",
+  "values": [
+    {"name": "AzureFrontDoor.Backend", "id": "AzureFrontDoor.Backend",
+     "properties": {"changeNumber": 1, "region": "", "platform": "Azure", "systemService": "AzureFrontDoor",
+                    "addressPrefixes": ["13.73.248.16/29", "2603:1000:4::/48"]}},
+    {"name": "AzureCloud.westeurope", "id": "AzureCloud.westeurope",
+     "properties": {"changeNumber": 1, "region": "westeurope", "platform": "Azure", "systemService": "",
+                    "addressPrefixes": ["13.69.0.0/17"]}}
+  ]
+}`
+
+const githubMeta = `{
+  "verifiable_password_authentication": true,
+  "ssh_key_fingerprints": {"SHA256_RSA": "nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8"},
+  "hooks": ["192.30.252.0/22", "185.199.108.0/22", "2a0a:a440::/29"],
+  "web": ["192.30.252.0/22", "140.82.112.0/20"]
+}`
+
+func writeTestFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadAWSIPRanges(t *testing.T) {
+	path := writeTestFile(t, "ip-ranges.json", awsIPRanges)
+	tests := []struct {
+		name     string
+		selector IPRangeSelector
+		want     []string
+	}{
+		{"all prefixes", IPRangeSelector{}, []string{"3.5.140.0/22", "13.32.0.0/15", "18.184.0.0/15", "2600:9000:2000::/36", "2a05:d050:4000::/40"}},
+		{"only CloudFront", IPRangeSelector{Services: []string{"cloudfront"}}, []string{"13.32.0.0/15", "2600:9000:2000::/36"}},
+		{"service and region", IPRangeSelector{Services: []string{"EC2"}, Regions: []string{"eu-central-1"}}, []string{"18.184.0.0/15", "2a05:d050:4000::/40"}},
+		{"no match", IPRangeSelector{Regions: []string{"us-east-1"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadAWSIPRanges(path, tt.selector)
+			if err != nil {
+				t.Fatalf("LoadAWSIPRanges() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadAWSIPRanges() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadGCPIPRanges(t *testing.T) {
+	path := writeTestFile(t, "cloud.json", gcpIPRanges)
+	got, err := LoadGCPIPRanges(path, IPRangeSelector{Regions: []string{"europe-west3"}})
+	if err != nil {
+		t.Fatalf("LoadGCPIPRanges() error = %v", err)
+	}
+	want := []string{"2600:1900:8000::/44", "34.89.0.0/17"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadGCPIPRanges() got = %v, want %v", got, want)
+	}
+}
+
+func TestLoadAzureServiceTags(t *testing.T) {
+	path := writeTestFile(t, "ServiceTags_Public.json", azureServiceTags)
+	tests := []struct {
+		name     string
+		selector IPRangeSelector
+		want     []string
+	}{
+		{"by tag name", IPRangeSelector{Services: []string{"AzureFrontDoor.Backend"}}, []string{"13.73.248.16/29", "2603:1000:4::/48"}},
+		{"by system service", IPRangeSelector{Services: []string{"AzureFrontDoor"}}, []string{"13.73.248.16/29", "2603:1000:4::/48"}},
+		{"by region", IPRangeSelector{Regions: []string{"westeurope"}}, []string{"13.69.0.0/17"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadAzureServiceTags(path, tt.selector)
+			if err != nil {
+				t.Fatalf("LoadAzureServiceTags() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadAzureServiceTags() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadGitHubMeta(t *testing.T) {
+	path := writeTestFile(t, "meta.json", githubMeta)
+	tests := []struct {
+		name    string
+		lists   []string
+		want    []string
+		wantErr bool
+	}{
+		{"hooks by default", nil, []string{"192.30.252.0/22", "185.199.108.0/22", "2a0a:a440::/29"}, false},
+		{"several lists without duplicates", []string{"hooks", "web"}, []string{"192.30.252.0/22", "185.199.108.0/22", "2a0a:a440::/29", "140.82.112.0/20"}, false},
+		{"unknown list", []string{"pages"}, nil, true},
+		{"not a list of ranges", []string{"ssh_key_fingerprints"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadGitHubMeta(path, tt.lists...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadGitHubMeta() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadGitHubMeta() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadCloudflareIPs(t *testing.T) {
+	v4 := writeTestFile(t, "ips-v4", "173.245.48.0/20\n103.21.244.0/22\n")
+	v6 := writeTestFile(t, "ips-v6", "2400:cb00::/32\n")
+	got, err := LoadCloudflareIPs(v4, v6)
+	if err != nil {
+		t.Fatalf("LoadCloudflareIPs() error = %v", err)
+	}
+	want := []string{"173.245.48.0/20", "103.21.244.0/22", "2400:cb00::/32"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadCloudflareIPs() got = %v, want %v", got, want)
+	}
+	if _, err := NewIPList(got); err != nil {
+		t.Errorf("NewIPList() with Cloudflare ranges: %v", err)
+	}
+}
+
+func TestLoadInvalidDocument(t *testing.T) {
+	path := writeTestFile(t, "invalid.json", "<html>rate limited</html>")
+	if _, err := LoadAWSIPRanges(path, IPRangeSelector{}); err == nil {
+		t.Errorf("LoadAWSIPRanges() with invalid document: expected error")
+	}
+}
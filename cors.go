@@ -0,0 +1,202 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//CORSParams configures CORS.
+//AllowedOrigins are exact origins ("https://app.example.org"), origins with a wildcard subdomain
+//("https://*.example.org", which does not match "https://example.org" itself) or "*" for any origin.
+//AllowedOriginPatterns are regular expressions that must match the whole origin, which is lowercased before matching.
+//AllowedMethods default to GET, HEAD and POST. AllowedHeaders are the request headers the browser may send
+//in addition to the CORS-safelisted ones, "*" allows all. ExposedHeaders are the response headers
+//the browser makes available to scripts. If AllowCredentials is set, cookies and authorization headers are sent,
+//so AllowedOrigins must not contain "*". Browsers cache preflight results for MaxAge.
+type CORSParams struct {
+	AllowedOrigins        []string
+	AllowedOriginPatterns []string
+	AllowedMethods        []string
+	AllowedHeaders        []string
+	ExposedHeaders        []string
+	AllowCredentials      bool
+	MaxAge                time.Duration
+}
+
+type corsFilter struct {
+	next           http.Handler
+	params         CORSParams
+	anyOrigin      bool
+	origins        map[string]bool
+	wildcards      []string
+	patterns       []*regexp.Regexp
+	methods        map[string]bool
+	anyHeader      bool
+	headers        map[string]bool
+	allowedMethods string
+	exposedHeaders string
+}
+
+func (cf corsFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	preflight := r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != ""
+	header := w.Header()
+	header.Add("Vary", "Origin")
+	if preflight {
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+	}
+	if origin == "" {
+		cf.next.ServeHTTP(w, r)
+		return
+	}
+	if !cf.originAllowed(origin) {
+		if preflight {
+			WriteError(w, r, &DeniedError{Status: 403, Filter: "cors", Code: "origin_not_allowed", Reason: fmt.Sprintf("origin %s not allowed", origin)})
+			return
+		}
+		cf.next.ServeHTTP(w, r)
+		return
+	}
+
+	if cf.anyOrigin {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if cf.params.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if !preflight {
+		if cf.exposedHeaders != "" {
+			header.Set("Access-Control-Expose-Headers", cf.exposedHeaders)
+		}
+		cf.next.ServeHTTP(w, r)
+		return
+	}
+
+	// preflight requests are answered here and never reach the following handlers, which may
+	// require credentials that browsers do not send with preflight requests
+	method := r.Header.Get("Access-Control-Request-Method")
+	if !cf.methods[method] {
+		header.Del("Access-Control-Allow-Origin")
+		header.Del("Access-Control-Allow-Credentials")
+		WriteError(w, r, &DeniedError{Status: 403, Filter: "cors", Code: "method_not_allowed", Reason: fmt.Sprintf("method %s not allowed for origin %s", method, origin)})
+		return
+	}
+	requestedHeaders := parseHeaderList(r.Header.Values("Access-Control-Request-Headers"))
+	for _, requested := range requestedHeaders {
+		if !cf.anyHeader && !cf.headers[strings.ToLower(requested)] {
+			header.Del("Access-Control-Allow-Origin")
+			header.Del("Access-Control-Allow-Credentials")
+			WriteError(w, r, &DeniedError{Status: 403, Filter: "cors", Code: "header_not_allowed", Reason: fmt.Sprintf("header %s not allowed for origin %s", requested, origin)})
+			return
+		}
+	}
+	header.Set("Access-Control-Allow-Methods", cf.allowedMethods)
+	if len(requestedHeaders) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(requestedHeaders, ", "))
+	}
+	if cf.params.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(cf.params.MaxAge.Seconds())))
+	}
+	w.WriteHeader(204)
+}
+
+func (cf corsFilter) originAllowed(origin string) bool {
+	origin = strings.ToLower(origin)
+	if cf.anyOrigin || cf.origins[origin] {
+		return true
+	}
+	for _, wildcard := range cf.wildcards {
+		scheme, suffix, _ := strings.Cut(wildcard, "*")
+		rest := origin
+		if strings.HasPrefix(rest, scheme) && strings.HasSuffix(rest, suffix) && len(rest) > len(scheme)+len(suffix) {
+			subdomain := rest[len(scheme) : len(rest)-len(suffix)]
+			if !strings.ContainsAny(subdomain, "/:@") {
+				return true
+			}
+		}
+	}
+	for _, pattern := range cf.patterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseHeaderList(values []string) []string {
+	var headers []string
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				headers = append(headers, name)
+			}
+		}
+	}
+	return headers
+}
+
+//CORS allows cross-origin requests from browsers according to the Cross-Origin Resource Sharing protocol.
+//It answers preflight requests itself, so it must come before filters that authenticate requests, since browsers
+//do not send credentials with preflight requests:
+//  cors := middleware.CORS(middleware.CORSParams{
+//  	AllowedOrigins:   []string{"https://app.example.org", "https://*.preview.example.org"},
+//  	AllowedMethods:   []string{"GET", "POST", "DELETE"},
+//  	AllowedHeaders:   []string{"Authorization", "Content-Type"},
+//  	AllowCredentials: true,
+//  	MaxAge:           time.Hour,
+//  })
+//  mux.Handle("/api/", middleware.Assemble(cors, requireToken).ApplyToFunc(handler))
+//It panics if one of the AllowedOriginPatterns is not a valid regular expression, or if AllowedOrigins
+//contains "*" and AllowCredentials is set, which would let any website send authenticated requests.
+func CORS(params CORSParams) func(http.Handler) http.Handler {
+	cf := corsFilter{params: params, origins: make(map[string]bool), methods: make(map[string]bool), headers: make(map[string]bool)}
+	for _, origin := range params.AllowedOrigins {
+		origin = strings.ToLower(origin)
+		switch {
+		case origin == "*":
+			if params.AllowCredentials {
+				panic("Failed to create CORS filter: any origin (\"*\") must not be combined with AllowCredentials")
+			}
+			cf.anyOrigin = true
+		case strings.Contains(origin, "*"):
+			cf.wildcards = append(cf.wildcards, origin)
+		default:
+			cf.origins[origin] = true
+		}
+	}
+	for _, pattern := range params.AllowedOriginPatterns {
+		expression, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			panic(fmt.Sprintf("Failed to compile origin pattern %s: %s", pattern, err))
+		}
+		cf.patterns = append(cf.patterns, expression)
+	}
+	methods := params.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{"GET", "HEAD", "POST"}
+	}
+	for _, method := range methods {
+		cf.methods[strings.ToUpper(method)] = true
+	}
+	cf.allowedMethods = strings.ToUpper(strings.Join(methods, ", "))
+	for _, name := range params.AllowedHeaders {
+		if name == "*" {
+			cf.anyHeader = true
+		}
+		cf.headers[strings.ToLower(name)] = true
+	}
+	cf.exposedHeaders = strings.Join(params.ExposedHeaders, ", ")
+	fn := func(next http.Handler) http.Handler {
+		cf := cf
+		cf.next = next
+		return cf
+	}
+	return fn
+}
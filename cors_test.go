@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	params := CORSParams{
+		AllowedOrigins:        []string{"https://app.example.org", "https://*.preview.example.org"},
+		AllowedOriginPatterns: []string{`https://pr-\d+\.example\.dev`},
+		AllowedMethods:        []string{"GET", "POST", "DELETE"},
+		AllowedHeaders:        []string{"Authorization", "Content-Type"},
+		ExposedHeaders:        []string{"RateLimit-Remaining"},
+		AllowCredentials:      true,
+		MaxAge:                time.Hour,
+	}
+	public := CORSParams{AllowedOrigins: []string{"*"}}
+	tests := []struct {
+		name        string
+		params      CORSParams
+		method      string
+		header      http.Header
+		wantStatus  int
+		wantHeaders map[string]string
+		wantNext    bool
+	}{
+		{"same origin request", params, "GET", http.Header{}, 200,
+			map[string]string{"Access-Control-Allow-Origin": "", "Vary": "Origin"}, true},
+		{"allowed origin", params, "GET", http.Header{"Origin": {"https://app.example.org"}}, 200,
+			map[string]string{"Access-Control-Allow-Origin": "https://app.example.org", "Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers": "RateLimit-Remaining", "Vary": "Origin"}, true},
+		{"wildcard subdomain", params, "GET", http.Header{"Origin": {"https://feature-1.preview.example.org"}}, 200,
+			map[string]string{"Access-Control-Allow-Origin": "https://feature-1.preview.example.org"}, true},
+		{"wildcard does not match parent domain", params, "GET", http.Header{"Origin": {"https://preview.example.org"}}, 200,
+			map[string]string{"Access-Control-Allow-Origin": ""}, true},
+		{"wildcard does not match other host", params, "GET", http.Header{"Origin": {"https://evil.org/.preview.example.org"}}, 200,
+			map[string]string{"Access-Control-Allow-Origin": ""}, true},
+		{"origin pattern", params, "GET", http.Header{"Origin": {"https://pr-42.example.dev"}}, 200,
+			map[string]string{"Access-Control-Allow-Origin": "https://pr-42.example.dev"}, true},
+		{"origin pattern ignores case", params, "GET", http.Header{"Origin": {"https://PR-42.Example.dev"}}, 200,
+			map[string]string{"Access-Control-Allow-Origin": "https://PR-42.Example.dev"}, true},
+		{"origin pattern must match completely", params, "GET", http.Header{"Origin": {"https://pr-42.example.dev.evil.org"}}, 200,
+			map[string]string{"Access-Control-Allow-Origin": ""}, true},
+		{"disallowed origin", params, "GET", http.Header{"Origin": {"https://evil.org"}}, 200,
+			map[string]string{"Access-Control-Allow-Origin": ""}, true},
+		{"preflight", params, "OPTIONS", http.Header{"Origin": {"https://app.example.org"}, "Access-Control-Request-Method": {"DELETE"},
+			"Access-Control-Request-Headers": {"authorization, content-type"}}, 204,
+			map[string]string{"Access-Control-Allow-Origin": "https://app.example.org", "Access-Control-Allow-Methods": "GET, POST, DELETE",
+				"Access-Control-Allow-Headers": "authorization, content-type", "Access-Control-Max-Age": "3600",
+				"Access-Control-Allow-Credentials": "true"}, false},
+		{"preflight with disallowed method", params, "OPTIONS", http.Header{"Origin": {"https://app.example.org"}, "Access-Control-Request-Method": {"PUT"}}, 403,
+			map[string]string{"Access-Control-Allow-Origin": ""}, false},
+		{"preflight with disallowed header", params, "OPTIONS", http.Header{"Origin": {"https://app.example.org"}, "Access-Control-Request-Method": {"POST"},
+			"Access-Control-Request-Headers": {"X-Debug"}}, 403, map[string]string{"Access-Control-Allow-Origin": ""}, false},
+		{"preflight from disallowed origin", params, "OPTIONS", http.Header{"Origin": {"https://evil.org"}, "Access-Control-Request-Method": {"GET"}}, 403,
+			map[string]string{"Access-Control-Allow-Origin": ""}, false},
+		{"OPTIONS without preflight", params, "OPTIONS", http.Header{"Origin": {"https://app.example.org"}}, 200,
+			map[string]string{"Access-Control-Allow-Origin": "https://app.example.org"}, true},
+		{"any origin", public, "GET", http.Header{"Origin": {"https://somewhere.org"}}, 200,
+			map[string]string{"Access-Control-Allow-Origin": "*", "Access-Control-Allow-Credentials": ""}, true},
+		{"default methods", public, "OPTIONS", http.Header{"Origin": {"https://somewhere.org"}, "Access-Control-Request-Method": {"POST"}}, 204,
+			map[string]string{"Access-Control-Allow-Methods": "GET, HEAD, POST", "Access-Control-Max-Age": ""}, false},
+		{"any header", CORSParams{AllowedOrigins: []string{"*"}, AllowedHeaders: []string{"*"}}, "OPTIONS", http.Header{"Origin": {"https://somewhere.org"},
+			"Access-Control-Request-Method": {"GET"}, "Access-Control-Request-Headers": {"X-Custom"}}, 204,
+			map[string]string{"Access-Control-Allow-Headers": "X-Custom"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nextCalled := false
+			handler := CORS(tt.params)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				nextCalled = true
+			}))
+			request := httptest.NewRequest(tt.method, "/api", nil)
+			request.Header = tt.header
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("CORS() status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if nextCalled != tt.wantNext {
+				t.Errorf("CORS() called next handler = %v, want %v", nextCalled, tt.wantNext)
+			}
+			for name, want := range tt.wantHeaders {
+				if got := recorder.Header().Get(name); got != want {
+					t.Errorf("CORS() header %s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCORS_beforeFilters(t *testing.T) {
+	cors := CORS(CORSParams{AllowedOrigins: []string{"https://app.example.org"}, AllowedMethods: []string{"POST"}, AllowedHeaders: []string{"X-Signature"}})
+	hmac := HmacFilter(HmacParams{Secret: "secret", HmacSource: "X-Signature"})
+	headers := FilterHeaders(http.Header{"X-Api-Version": {"2"}})
+	handler := Assemble(cors, headers, hmac).ApplyToFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	preflight := httptest.NewRequest("OPTIONS", "/hooks", nil)
+	preflight.Header.Set("Origin", "https://app.example.org")
+	preflight.Header.Set("Access-Control-Request-Method", "POST")
+	preflight.Header.Set("Access-Control-Request-Headers", "X-Signature")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, preflight)
+	if recorder.Code != 204 {
+		t.Errorf("preflight status = %d, want 204", recorder.Code)
+	}
+
+	request := httptest.NewRequest("POST", "/hooks", nil)
+	request.Header.Set("Origin", "https://app.example.org")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != 403 || recorder.Header().Get("Access-Control-Allow-Origin") != "https://app.example.org" {
+		t.Errorf("request without credentials: status = %d, Access-Control-Allow-Origin = %s", recorder.Code, recorder.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
+
+func TestCORS_invalidPattern(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("CORS() with invalid origin pattern should panic")
+		}
+	}()
+	CORS(CORSParams{AllowedOriginPatterns: []string{"https://(.example.org"}})
+}
+
+func TestCORS_anyOriginWithCredentials(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("CORS() with any origin and credentials should panic")
+		}
+	}()
+	CORS(CORSParams{AllowedOrigins: []string{"*"}, AllowCredentials: true})
+}
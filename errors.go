@@ -0,0 +1,214 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+//ErrorHandler is a handler that returns an error instead of writing it to the response itself.
+//The error is written with WriteError, so that it is rendered by the HandleErrors middleware of the chain:
+//  mux.Handle("/users/", middleware.ErrorHandler(func(w http.ResponseWriter, r *http.Request) error {
+//  	user, err := loadUser(r.PathValue("id"))
+//  	if err != nil {
+//  		return err
+//  	}
+//  	return json.NewEncoder(w).Encode(user)
+//  }))
+type ErrorHandler func(w http.ResponseWriter, r *http.Request) error
+
+//ServeHTTP implements the http.Handler interface
+func (h ErrorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h(w, r); err != nil {
+		WriteError(w, r, err)
+	}
+}
+
+//ErrorMiddleware creates a middleware from a function that returns an error instead of writing it to the response.
+//The function calls next to continue the chain:
+//  requireTenant := middleware.ErrorMiddleware(func(w http.ResponseWriter, r *http.Request, next http.Handler) error {
+//  	if r.Header.Get("X-Tenant") == "" {
+//  		return &middleware.HTTPError{Status: 400, Message: "X-Tenant header missing"}
+//  	}
+//  	next.ServeHTTP(w, r)
+//  	return nil
+//  })
+func ErrorMiddleware(fn func(w http.ResponseWriter, r *http.Request, next http.Handler) error) Middleware {
+	return func(next http.Handler) http.Handler {
+		return ErrorHandler(func(w http.ResponseWriter, r *http.Request) error {
+			return fn(w, r, next)
+		})
+	}
+}
+
+//HTTPError is an error with the status code of the response. Message is sent to the client instead of
+//the status text, while Err is the cause of the error, which is only logged.
+type HTTPError struct {
+	Status  int
+	Message string
+	Err     error
+}
+
+func (e *HTTPError) Error() string {
+	message := e.Message
+	if message == "" {
+		message = http.StatusText(e.Status)
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("%d %s: %v", e.Status, message, e.Err)
+	}
+	return fmt.Sprintf("%d %s", e.Status, message)
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+//DeniedError is written by the filters of this package when they reject a request.
+//Filter names the filter, e.g. "hmac", Code is a short identifier of the cause, e.g. "invalid_signature",
+//and Reason describes in detail why the request was rejected. IP is the client IP the filter evaluated,
+//if it is not the remote address of the request.
+//The reason is logged, but not sent to the client.
+type DeniedError struct {
+	Status int
+	Filter string
+	Code   string
+	Reason string
+	IP     string
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("denied by %s filter: %s", e.Filter, e.Reason)
+}
+
+//ErrorParams configures HandleErrors.
+//Status maps errors to status codes. It is only called for errors that are neither an HTTPError nor a DeniedError,
+//if it is nil or returns 0, the status is 500.
+//Render writes the response. By default, denials are answered with the status only, other errors with the status
+//and the message of an HTTPError or the status text as plain text.
+//Log is called for every error before it is rendered. By default, denials and errors with a status of 500 or above
+//are logged with log.Printf, panics recovered by Recover including their stack.
+type ErrorParams struct {
+	Status func(err error) int
+	Render func(w http.ResponseWriter, r *http.Request, status int, err error)
+	Log    func(r *http.Request, status int, err error)
+}
+
+type errorHandler struct {
+	next   http.Handler
+	params ErrorParams
+}
+
+func (eh errorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := context.WithValue(r.Context(), errorHandlerKey, eh)
+	eh.next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+//errorHandlerFrom returns the errorHandler added to the context of the request by HandleErrors,
+//or one with default params
+func errorHandlerFrom(r *http.Request) errorHandler {
+	eh, _ := r.Context().Value(errorHandlerKey).(errorHandler)
+	return eh
+}
+
+func (eh errorHandler) handle(w http.ResponseWriter, r *http.Request, err error) {
+	recordError(r.Context(), err)
+	recordDenial(r.Context(), err)
+	recordFailure(r.Context(), err)
+	status := eh.status(err)
+	eh.log(r, status, err)
+	if eh.params.Render != nil {
+		eh.params.Render(w, r, status, err)
+	} else {
+		renderError(w, r, status, err)
+	}
+}
+
+func (eh errorHandler) status(err error) int {
+	status := 0
+	var httpError *HTTPError
+	var denied *DeniedError
+	switch {
+	case errors.As(err, &denied):
+		status = denied.Status
+	case errors.As(err, &httpError):
+		status = httpError.Status
+	case eh.params.Status != nil:
+		status = eh.params.Status(err)
+	}
+	if status == 0 {
+		status = 500
+	}
+	return status
+}
+
+func (eh errorHandler) log(r *http.Request, status int, err error) {
+	if eh.params.Log != nil {
+		eh.params.Log(r, status, err)
+	} else {
+		logError(r, status, err)
+	}
+}
+
+func logError(r *http.Request, status int, err error) {
+	var denied *DeniedError
+	var panicked *PanicError
+	if errors.As(err, &denied) {
+		ip := denied.IP
+		if ip == "" {
+			ip = r.RemoteAddr
+		}
+		log.Printf("IP %s is not permitted to access %s : %s%s \n", ip, r.URL, denied.Reason, requestIDSuffix(r))
+	} else if errors.As(err, &panicked) {
+		log.Printf("Recovered from panic in request from IP %s to %s : %v%s \n%s", r.RemoteAddr, r.URL, panicked.Value, requestIDSuffix(r), panicked.Stack)
+	} else if status >= 500 {
+		log.Printf("Failed to handle request from IP %s to %s : %v%s \n", r.RemoteAddr, r.URL, err, requestIDSuffix(r))
+	}
+}
+
+func renderError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	var denied *DeniedError
+	if errors.As(err, &denied) {
+		w.WriteHeader(status)
+		return
+	}
+	message := http.StatusText(status)
+	var httpError *HTTPError
+	if errors.As(err, &httpError) && httpError.Message != "" {
+		message = httpError.Message
+	}
+	http.Error(w, message, status)
+}
+
+//HandleErrors renders all errors that are written with WriteError by the following handlers, including
+//the denials of the filters of this package, to give all error responses of an application the same form:
+//  errs := middleware.HandleErrors(middleware.ErrorParams{
+//  	Status: func(err error) int {
+//  		if errors.Is(err, sql.ErrNoRows) {
+//  			return 404
+//  		}
+//  		return 0
+//  	},
+//  	Render: func(w http.ResponseWriter, r *http.Request, status int, err error) {
+//  		w.Header().Set("Content-Type", "application/problem+json")
+//  		w.WriteHeader(status)
+//  		json.NewEncoder(w).Encode(map[string]any{"status": status, "title": http.StatusText(status)})
+//  	},
+//  })
+//  mux.Handle("/", middleware.Assemble(errs, hmac).ApplyToFunc(handler))
+//Without HandleErrors, errors are logged and rendered as described for ErrorParams.
+func HandleErrors(params ErrorParams) func(http.Handler) http.Handler {
+	fn := func(next http.Handler) http.Handler {
+		return errorHandler{next: next, params: params}
+	}
+	return fn
+}
+
+//WriteError writes the error to the response using the HandleErrors middleware that precedes the handler.
+//Middlewares should use it to reject requests, so that their responses are rendered like all other errors:
+//  middleware.WriteError(w, r, &middleware.HTTPError{Status: 413, Message: "body too large"})
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	errorHandlerFrom(r).handle(w, r, err)
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorHandler(t *testing.T) {
+	errNotFound := errors.New("not found")
+	custom := ErrorParams{
+		Status: func(err error) int {
+			if errors.Is(err, errNotFound) {
+				return 404
+			}
+			return 0
+		},
+		Render: func(w http.ResponseWriter, r *http.Request, status int, err error) {
+			w.WriteHeader(status)
+			fmt.Fprintf(w, `{"status":%d}`, status)
+		},
+	}
+	tests := []struct {
+		name       string
+		params     *ErrorParams
+		err        error
+		wantStatus int
+		wantBody   string
+	}{
+		{"no error", nil, nil, 200, "ok"},
+		{"default for plain error", nil, errors.New("database down"), 500, "Internal Server Error\n"},
+		{"default for HTTP error", nil, &HTTPError{Status: 400, Message: "name missing"}, 400, "name missing\n"},
+		{"default for wrapped HTTP error", nil, fmt.Errorf("validating: %w", &HTTPError{Status: 422}), 422, "Unprocessable Entity\n"},
+		{"default for denial", nil, &DeniedError{Status: 403, Filter: "test", Reason: "test"}, 403, ""},
+		{"handle errors with default params", &ErrorParams{}, &HTTPError{Status: 409, Err: errors.New("conflict")}, 409, "Conflict\n"},
+		{"status mapping", &custom, fmt.Errorf("user 42: %w", errNotFound), 404, `{"status":404}`},
+		{"unmapped error", &custom, errors.New("database down"), 500, `{"status":500}`},
+		{"HTTP error is not mapped", &custom, &HTTPError{Status: 400, Err: errNotFound}, 400, `{"status":400}`},
+		{"denial is rendered", &custom, &DeniedError{Status: 429, Filter: "test", Reason: "test"}, 429, `{"status":429}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handler http.Handler = ErrorHandler(func(w http.ResponseWriter, r *http.Request) error {
+				if tt.err != nil {
+					return tt.err
+				}
+				_, err := io.WriteString(w, "ok")
+				return err
+			})
+			if tt.params != nil {
+				handler = HandleErrors(*tt.params)(handler)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+			if recorder.Code != tt.wantStatus || recorder.Body.String() != tt.wantBody {
+				t.Errorf("response = %d %q, want %d %q", recorder.Code, recorder.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestErrorMiddleware(t *testing.T) {
+	requireTenant := ErrorMiddleware(func(w http.ResponseWriter, r *http.Request, next http.Handler) error {
+		if r.Header.Get("X-Tenant") == "" {
+			return &HTTPError{Status: 400, Message: "X-Tenant header missing"}
+		}
+		next.ServeHTTP(w, r)
+		return nil
+	})
+	handler := requireTenant.ApplyToFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	if recorder.Code != 400 || recorder.Body.String() != "X-Tenant header missing\n" {
+		t.Errorf("without tenant: %d %q", recorder.Code, recorder.Body.String())
+	}
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("X-Tenant", "acme")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != 200 || recorder.Body.String() != "ok" {
+		t.Errorf("with tenant: %d %q", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestHandleErrors_filterDenials(t *testing.T) {
+	var logged []error
+	errs := HandleErrors(ErrorParams{
+		Render: func(w http.ResponseWriter, r *http.Request, status int, err error) {
+			http.Error(w, "denied", status)
+		},
+		Log: func(r *http.Request, status int, err error) {
+			logged = append(logged, err)
+		},
+	})
+	hmac := HmacFilter(HmacParams{Secret: "secret", HmacSource: "X-Signature"})
+	handler := Assemble(errs, hmac).ApplyToFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("POST", "/hooks", nil))
+	if recorder.Code != 403 || recorder.Body.String() != "denied\n" {
+		t.Errorf("response = %d %q, want 403 %q", recorder.Code, recorder.Body.String(), "denied\n")
+	}
+	var denied *DeniedError
+	if len(logged) != 1 || !errors.As(logged[0], &denied) || denied.Filter != "hmac" {
+		t.Errorf("logged errors = %v, want denial of hmac filter", logged)
+	}
+}
@@ -3,11 +3,10 @@ package middleware_test
 import (
 	"fmt"
 	"github.com/seb-ehm/middleware"
-	"log"
 	"net/http"
 )
 
-func ExampleHeaderFilter() {
+func ExampleFilterHeaders() {
 	mux := http.NewServeMux()
 	//Some handler that prints both to stdout and the http response
 	handler := func(w http.ResponseWriter, r *http.Request) {
@@ -20,7 +19,7 @@ func ExampleHeaderFilter() {
 
 	mux.Handle("/authenticated", authenticated.ApplyToFunc(handler))
 
-	go func() { log.Fatal(http.ListenAndServe("localhost:9193", mux)) }()
+	Serve("localhost:9193", mux)
 
 	_, status := GetWebsiteWithHeader("http://localhost:9193/authenticated", "mysecretkey", "wrongvalue")
 	content, _ := GetWebsiteWithHeader("http://localhost:9193/authenticated", "mysecretkey", "mysecretvalue")
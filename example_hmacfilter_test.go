@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/seb-ehm/middleware"
-	"log"
 	"net/http"
 )
 
@@ -20,7 +19,7 @@ func ExampleHmacFilter() {
 
 	mux.Handle("/authenticated", authenticated.ApplyToFunc(handler))
 
-	go func() { log.Fatal(http.ListenAndServe("localhost:9194", mux)) }()
+	Serve("localhost:9194", mux)
 	client := &http.Client{}
 	validRequest, _ := http.NewRequest("POST", "http://localhost:9194/authenticated", bytes.NewBuffer([]byte("ThisIsARequest")))
 	validRequest.Header.Add("X-Hub-Signature", "sha1=8c08e9b7e2bdb4d87982f40d6bf6d36c0d0caab4")
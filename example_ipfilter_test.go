@@ -3,7 +3,6 @@ package middleware_test
 import (
 	"fmt"
 	"github.com/seb-ehm/middleware"
-	"log"
 	"net/http"
 )
 
@@ -27,7 +26,7 @@ func ExampleIPFilter() {
 	mux.Handle("/localhost", localhost.ApplyToFunc(handler))
 	mux.Handle("/localhostinheader", localhostInHeader.ApplyToFunc(handler))
 
-	go func() { log.Fatal(http.ListenAndServe("localhost:9192", mux)) }()
+	Serve("localhost:9192", mux)
 
 	_, status := GetWebsite("http://localhost:9192/nolocalhost")
 	fmt.Println(status)
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 
 	"github.com/seb-ehm/middleware"
@@ -39,8 +40,21 @@ func GetGreeting(message string) func(http.Handler) http.Handler {
 	return fn
 }
 
+//Serve starts listening on addr before serving handler in the background,
+//so that requests made right after calling it do not fail
+func Serve(addr string, handler http.Handler) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		panic(err)
+	}
+	go func() { log.Fatal(http.Serve(listener, handler)) }()
+}
+
 func GetWebsite(url string) (string, string) {
 	resp, err := http.Get(url)
+	if err != nil {
+		panic(err)
+	}
 	defer resp.Body.Close()
 	html, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -55,6 +69,9 @@ func GetWebsiteWithHeader(url string, headerName string, headerValue string) (st
 	request, _ := http.NewRequest("GET", url, nil)
 	request.Header.Add(headerName, headerValue)
 	resp, err := client.Do(request)
+	if err != nil {
+		panic(err)
+	}
 	defer resp.Body.Close()
 	html, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -95,7 +112,7 @@ func ExampleMiddleware() {
 	//middleware can also be applied to a final handler
 	mux.Handle("/assembly", assembly.ApplyToFunc(handler))
 
-	go func() { log.Fatal(http.ListenAndServe("localhost:9191", mux)) }()
+	Serve("localhost:9191", mux)
 
 	content, _ := GetWebsite("http://localhost:9191/greetings")
 	fmt.Println(content)
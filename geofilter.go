@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/textproto"
+)
+
+type geoFilter struct {
+	next   http.Handler
+	params GeoParams
+}
+
+//GeoParams configures GeoFilter. A client is permitted if it matches Allow (or Allow is empty) and does not match Deny.
+//Entries of all Databases are combined, so that e.g. a country database and an ASN database can be used together.
+//IPHeader has the same meaning as the header parameter of IPFilter.
+type GeoParams struct {
+	Databases []*GeoDB
+	Allow     GeoMatch
+	Deny      GeoMatch
+	IPHeader  string
+}
+
+//GeoMatch matches clients by country code, continent code or autonomous system number.
+//A client matches if any of the given values matches its database entry. Codes are compared case-insensitively.
+type GeoMatch struct {
+	Countries  []string
+	Continents []string
+	ASNs       []uint32
+}
+
+func (gm GeoMatch) isEmpty() bool {
+	return len(gm.Countries) == 0 && len(gm.Continents) == 0 && len(gm.ASNs) == 0
+}
+
+func (gm GeoMatch) matches(record GeoRecord) bool {
+	if record.Country != "" && containsFold(gm.Countries, record.Country) {
+		return true
+	}
+	if record.Continent != "" && containsFold(gm.Continents, record.Continent) {
+		return true
+	}
+	for _, asn := range gm.ASNs {
+		if record.ASN != 0 && asn == record.ASN {
+			return true
+		}
+	}
+	return false
+}
+
+func (gf geoFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ip, ok := clientIP(r, gf.params.IPHeader)
+	if !ok {
+		denyMissingIPHeader(w, r, "geo", gf.params.IPHeader)
+		return
+	}
+	record, err := gf.lookup(ip)
+	if err != nil {
+		WriteError(w, r, &DeniedError{Status: 403, Filter: "geo", Code: "lookup_failed", Reason: fmt.Sprintf("geo lookup failed: %v", err), IP: ip})
+		return
+	}
+
+	permitted := (gf.params.Allow.isEmpty() || gf.params.Allow.matches(record)) && !gf.params.Deny.matches(record)
+	if permitted {
+		gf.next.ServeHTTP(w, r)
+	} else {
+		reason := fmt.Sprintf("country %q, continent %q, ASN %d", record.Country, record.Continent, record.ASN)
+		WriteError(w, r, &DeniedError{Status: 403, Filter: "geo", Code: "location_not_permitted", Reason: reason, IP: ip})
+	}
+}
+
+func (gf geoFilter) lookup(ip string) (GeoRecord, error) {
+	var combined GeoRecord
+	address := getIpFromString(ip)
+	if address == nil {
+		return combined, fmt.Errorf("invalid IP: %s", ip)
+	}
+	for _, db := range gf.params.Databases {
+		record, found, err := db.Lookup(address)
+		if err != nil {
+			return combined, err
+		}
+		if !found {
+			continue
+		}
+		if combined.Country == "" {
+			combined.Country = record.Country
+		}
+		if combined.Continent == "" {
+			combined.Continent = record.Continent
+		}
+		if combined.ASN == 0 {
+			combined.ASN = record.ASN
+			combined.ASOrganization = record.ASOrganization
+		}
+	}
+	return combined, nil
+}
+
+//GeoFilter permits or rejects requests based on the location or network of the client ip address,
+//as found in local MaxMind DB files. Clients without an entry in any database only pass if Allow is empty.
+//  countries, err := middleware.OpenGeoDB("GeoLite2-Country.mmdb")
+//  noEmbargo := middleware.GeoFilter(middleware.GeoParams{
+//  	Databases: []*middleware.GeoDB{countries},
+//  	Deny:      middleware.GeoMatch{Countries: []string{"KP", "IR"}},
+//  })
+func GeoFilter(params GeoParams) func(http.Handler) http.Handler {
+	params.IPHeader = textproto.CanonicalMIMEHeaderKey(params.IPHeader)
+	fn := func(next http.Handler) http.Handler {
+		return geoFilter{next, params}
+	}
+	return fn
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGeoFilter(t *testing.T) {
+	data, networks := testGeoData()
+	db, err := newGeoDB(buildTestMMDB(24, data, networks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	databases := []*GeoDB{db}
+
+	tests := []struct {
+		name       string
+		params     GeoParams
+		remoteAddr string
+		headers    http.Header
+		want       int
+	}{
+		{"allow country", GeoParams{Databases: databases, Allow: GeoMatch{Countries: []string{"de"}}}, "81.2.69.142:1234", nil, 200},
+		{"allow other country", GeoParams{Databases: databases, Allow: GeoMatch{Countries: []string{"FR"}}}, "81.2.69.142:1234", nil, 403},
+		{"allow continent", GeoParams{Databases: databases, Allow: GeoMatch{Continents: []string{"EU"}}}, "[2001:db8::1]:1234", nil, 200},
+		{"allow unknown client", GeoParams{Databases: databases, Allow: GeoMatch{Continents: []string{"EU"}}}, "8.8.8.8:1234", nil, 403},
+		{"deny country", GeoParams{Databases: databases, Deny: GeoMatch{Countries: []string{"FR"}}}, "[2001:db8::1]:1234", nil, 403},
+		{"deny unknown client", GeoParams{Databases: databases, Deny: GeoMatch{Countries: []string{"FR"}}}, "8.8.8.8:1234", nil, 200},
+		{"deny ASN", GeoParams{Databases: databases, Deny: GeoMatch{ASNs: []uint32{3320}}}, "80.130.1.1:1234", nil, 403},
+		{"allow continent, deny country", GeoParams{Databases: databases, Allow: GeoMatch{Continents: []string{"EU"}}, Deny: GeoMatch{Countries: []string{"DE"}}}, "81.2.69.142:1234", nil, 403},
+		{"ip header", GeoParams{Databases: databases, Allow: GeoMatch{Countries: []string{"DE"}}, IPHeader: "x-forwarded-for"}, "8.8.8.8:1234", http.Header{"X-Forwarded-For": {"81.2.69.142"}}, 200},
+		{"bare IPv6 in ip header", GeoParams{Databases: databases, Allow: GeoMatch{Continents: []string{"EU"}}, IPHeader: "X-Real-IP"}, "8.8.8.8:1234",
+			http.Header{"X-Real-Ip": {"2001:db8::1"}}, 200},
+		{"missing ip header", GeoParams{Databases: databases, Deny: GeoMatch{Countries: []string{"FR"}}, IPHeader: "X-Forwarded-For"}, "8.8.8.8:1234", nil, 403},
+		{"invalid ip", GeoParams{Databases: databases, Deny: GeoMatch{Countries: []string{"FR"}}}, "invalid", nil, 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := GeoFilter(tt.params)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			request := httptest.NewRequest("GET", "/", nil)
+			request.RemoteAddr = tt.remoteAddr
+			for key, values := range tt.headers {
+				request.Header[key] = values
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != tt.want {
+				t.Errorf("GeoFilter() status = %d, want %d", recorder.Code, tt.want)
+			}
+		})
+	}
+}
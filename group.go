@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+//Group registers handlers on a http.ServeMux below a common path prefix, wrapped in a common chain of middlewares.
+//Nested groups extend the prefix and the chain of their parent, so a handler registered on a group always passes
+//through all middlewares of its ancestors:
+//  mux := http.NewServeMux()
+//  root := middleware.NewGroup(mux, middleware.Named("logging", logging))
+//  api := root.Group("/api", middleware.Named("token", requireToken))
+//  api.Get("/users/{id}", getUser)
+//  api.With(middleware.Named("admin", middleware.Authorize(adminParams))).Delete("/users/{id}", deleteUser)
+//  root.Get("/health", health)
+//Patterns follow the syntax of http.ServeMux, including methods and wildcards, but must not contain a host.
+type Group struct {
+	mux    *http.ServeMux
+	prefix string
+	chain  Chain
+	routes *routeTable
+}
+
+//Route is a pattern registered through a group together with the chain its handler is wrapped in
+type Route struct {
+	Pattern string
+	Chain   Chain
+}
+
+type routeTable struct {
+	sync.Mutex
+	routes []Route
+}
+
+//NewGroup creates a group without prefix that registers its handlers on mux.
+//If mux is nil, a new http.ServeMux is created; the group itself can then be used as handler.
+func NewGroup(mux *http.ServeMux, entries ...Entry) *Group {
+	if mux == nil {
+		mux = http.NewServeMux()
+	}
+	return &Group{mux: mux, chain: NewChain(entries...), routes: &routeTable{}}
+}
+
+//Group creates a nested group with the prefix appended to the prefix of g and the entries
+//appended to the chain of g. It panics if the prefix does not start with "/".
+func (g *Group) Group(prefix string, entries ...Entry) *Group {
+	if !strings.HasPrefix(prefix, "/") {
+		panic(fmt.Sprintf("Failed to create group %s: prefix must start with /", prefix))
+	}
+	return &Group{mux: g.mux, prefix: g.join(prefix), chain: g.chain.Append(entries...), routes: g.routes}
+}
+
+//With creates a group with the same prefix as g and the entries appended to its chain,
+//to add middlewares to single routes:
+//  api.With(middleware.Named("ratelimit", rateLimit)).Post("/login", login)
+func (g *Group) With(entries ...Entry) *Group {
+	return &Group{mux: g.mux, prefix: g.prefix, chain: g.chain.Append(entries...), routes: g.routes}
+}
+
+//Chain returns the chain that wraps the handlers registered on the group
+func (g *Group) Chain() Chain {
+	return g.chain
+}
+
+//Handle registers the handler for the pattern below the prefix of the group, e.g. "GET /users/{id}".
+//The chain of the group is sorted according to the ordering constraints of its entries, see Chain.Sort.
+//It panics if the path of the pattern does not start with "/", if the constraints cannot be satisfied
+//or if http.ServeMux rejects the pattern.
+func (g *Group) Handle(pattern string, handler http.Handler) {
+	method, path, found := strings.Cut(pattern, " ")
+	if !found {
+		method, path = "", pattern
+	}
+	path = strings.TrimLeft(path, " \t")
+	if !strings.HasPrefix(path, "/") {
+		panic(fmt.Sprintf("Failed to register %s: path must start with /", pattern))
+	}
+	pattern = g.join(path)
+	if method != "" {
+		pattern = method + " " + pattern
+	}
+	chain, err := g.chain.Sort()
+	if err != nil {
+		panic(fmt.Sprintf("Failed to register %s: %s", pattern, err))
+	}
+	routed := chain.Then(handler)
+	g.mux.Handle(pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recordRoute(r)
+		routed.ServeHTTP(w, r)
+	}))
+	g.routes.Lock()
+	defer g.routes.Unlock()
+	g.routes.routes = append(g.routes.routes, Route{Pattern: pattern, Chain: chain})
+}
+
+//HandleFunc registers the handler function for the pattern, see Handle
+func (g *Group) HandleFunc(pattern string, handler http.HandlerFunc) {
+	g.Handle(pattern, handler)
+}
+
+//Get registers the handler function for GET requests to the path, which also matches HEAD requests
+func (g *Group) Get(path string, handler http.HandlerFunc) {
+	g.Handle("GET "+path, handler)
+}
+
+//Post registers the handler function for POST requests to the path
+func (g *Group) Post(path string, handler http.HandlerFunc) {
+	g.Handle("POST "+path, handler)
+}
+
+//Put registers the handler function for PUT requests to the path
+func (g *Group) Put(path string, handler http.HandlerFunc) {
+	g.Handle("PUT "+path, handler)
+}
+
+//Patch registers the handler function for PATCH requests to the path
+func (g *Group) Patch(path string, handler http.HandlerFunc) {
+	g.Handle("PATCH "+path, handler)
+}
+
+//Delete registers the handler function for DELETE requests to the path
+func (g *Group) Delete(path string, handler http.HandlerFunc) {
+	g.Handle("DELETE "+path, handler)
+}
+
+//ServeHTTP dispatches the request to the http.ServeMux of the group
+func (g *Group) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mux.ServeHTTP(w, r)
+}
+
+//Routes returns all routes registered through g, its parents and all groups derived from them, in the order of registration
+func (g *Group) Routes() []Route {
+	g.routes.Lock()
+	defer g.routes.Unlock()
+	return append([]Route(nil), g.routes.routes...)
+}
+
+//DebugHandler lists the routes of the group with the chains of their handlers as plain text:
+//  GET /api/users/{id}: logging -> token
+//  DELETE /api/users/{id}: logging -> token -> admin
+//Since it reveals which filters protect which routes, it should itself be protected:
+//  root.With(middleware.Named("admin", requireAdmin)).Handle("GET /debug/chains", root.DebugHandler())
+func (g *Group) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, route := range g.Routes() {
+			fmt.Fprintf(w, "%s: %s\n", route.Pattern, route.Chain)
+		}
+	})
+}
+
+func (g *Group) join(path string) string {
+	return strings.TrimSuffix(g.prefix, "/") + path
+}
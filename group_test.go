@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	trace := func(name string) Entry {
+		return Named(name, func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("X-Trace", name)
+				next.ServeHTTP(w, r)
+			})
+		})
+	}
+	respond := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %s", name, r.PathValue("id"))
+		}
+	}
+	root := NewGroup(nil, trace("root"))
+	root.Get("/health", respond("health"))
+	api := root.Group("/api/", trace("api"))
+	api.Get("/users/{id}", respond("get"))
+	api.With(trace("admin")).Delete("/users/{id}", respond("delete"))
+	v2 := api.Group("/v2", trace("v2"))
+	v2.HandleFunc("/items/", respond("items"))
+	v2.Handle("POST  /items/{id}", respond("create"))
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+		wantBody   string
+		wantTrace  []string
+	}{
+		{"root route", "GET", "/health", 200, "health ", []string{"root"}},
+		{"nested route with wildcard", "GET", "/api/users/42", 200, "get 42", []string{"root", "api"}},
+		{"HEAD matches GET", "HEAD", "/api/users/42", 200, "get 42", []string{"root", "api"}},
+		{"route middleware", "DELETE", "/api/users/42", 200, "delete 42", []string{"root", "api", "admin"}},
+		{"method not allowed", "PUT", "/api/users/42", 405, "", nil},
+		{"subtree of nested group", "GET", "/api/v2/items/a/b", 200, "items ", []string{"root", "api", "v2"}},
+		{"method pattern of nested group", "POST", "/api/v2/items/7", 200, "create 7", []string{"root", "api", "v2"}},
+		{"prefix is not a route", "GET", "/api/users", 404, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			root.ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.target, nil))
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != 200 {
+				return
+			}
+			if got := recorder.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+			if got := recorder.Header().Values("X-Trace"); fmt.Sprint(got) != fmt.Sprint(tt.wantTrace) {
+				t.Errorf("middlewares = %v, want %v", got, tt.wantTrace)
+			}
+		})
+	}
+}
+
+func TestGroup_invalidPatterns(t *testing.T) {
+	group := NewGroup(http.NewServeMux())
+	group.Get("/users", func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		name     string
+		register func()
+	}{
+		{"prefix without slash", func() { group.Group("api") }},
+		{"path without slash", func() { group.Get("users", nil) }},
+		{"host in pattern", func() { group.Handle("GET example.org/users", nil) }},
+		{"duplicate route", func() { group.Get("/users", func(w http.ResponseWriter, r *http.Request) {}) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s should panic", tt.name)
+				}
+			}()
+			tt.register()
+		})
+	}
+}
+
+func TestGroup_DebugHandler(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	root := NewGroup(nil, Named("cors", CORS(CORSParams{AllowedOrigins: []string{"*"}})))
+	root.Get("/health", handler)
+	hooks := root.Group("/hooks", Entry{Middleware: HmacFilter(HmacParams{Secret: "secret", HmacSource: "X-Signature"})})
+	hooks.Post("/github", handler)
+	hooks.With(Named("ratelimit", New())).Post("/gitlab", handler)
+	root.Handle("GET /debug/chains", root.DebugHandler())
+
+	recorder := httptest.NewRecorder()
+	root.ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/chains", nil))
+	want := "GET /health: cors\n" +
+		"POST /hooks/github: cors -> middleware.HmacFilter\n" +
+		"POST /hooks/gitlab: cors -> middleware.HmacFilter -> ratelimit\n" +
+		"GET /debug/chains: cors\n"
+	if got := recorder.Body.String(); got != want {
+		t.Errorf("DebugHandler() = %q, want %q", got, want)
+	}
+	if routes := hooks.Routes(); len(routes) != 4 || routes[2].Chain.String() != "cors -> middleware.HmacFilter -> ratelimit" {
+		t.Errorf("Routes() = %v", routes)
+	}
+}
+
+func TestGroup_ordering(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	root := NewGroup(nil, Entry{Name: "ratelimit", Middleware: New(), After: []string{"auth"}})
+	api := root.Group("/api", Entry{Name: "auth", Middleware: New(), Once: true})
+	api.Get("/users", handler)
+	if got := api.Routes()[0].Chain.String(); got != "auth -> ratelimit" {
+		t.Errorf("chain = %q, want %q", got, "auth -> ratelimit")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("registering a route with a duplicate entry should panic")
+		}
+	}()
+	api.With(Entry{Name: "auth", Middleware: New()}).Get("/admin", handler)
+}
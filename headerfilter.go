@@ -1,23 +1,25 @@
 package middleware
 
 import (
-	"log"
+	"fmt"
 	"net/http"
+	"regexp"
+	"strings"
 )
 
 type headerFilter struct {
-	next    http.Handler
-	headers http.Header
+	next http.Handler
+	rule HeaderRule
 }
 
 func (he headerFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	allHeadersPresent := AllHeadersPresent(he.headers, r.Header)
+	ruleSatisfied := he.rule(r.Header)
 
-	if allHeadersPresent {
+	if ruleSatisfied {
 		he.next.ServeHTTP(w, r)
 	} else {
-		w.WriteHeader(403)
-		log.Printf("IP %s is not permitted to access %s : header verification failed. Supplied headers: %v \n", r.RemoteAddr, r.URL, r.Header)
+		reason := fmt.Sprintf("header verification failed. Supplied headers: %v", r.Header)
+		WriteError(w, r, &DeniedError{Status: 403, Filter: "header", Code: "header_mismatch", Reason: reason})
 	}
 }
 
@@ -49,9 +51,201 @@ func AllHeadersPresent(requiredHeaders http.Header, requestHeaders http.Header)
 }
 
 func FilterHeaders(headers http.Header) func(http.Handler) http.Handler {
+	return FilterHeaderRules(HeadersPresent(headers))
+}
 
+//FilterHeaderRules permits requests whose headers satisfy rule:
+//  fromGitHub := middleware.HeaderMatches("User-Agent", middleware.ValuePrefix("GitHub-Hookshot/"))
+//  noDebug := middleware.HeaderAbsent("X-Debug")
+//  filter := middleware.FilterHeaderRules(fromGitHub.And(noDebug))
+func FilterHeaderRules(rule HeaderRule) func(http.Handler) http.Handler {
 	fn := func(next http.Handler) http.Handler {
-		return headerFilter{next, headers}
+		return headerFilter{next, rule}
 	}
 	return fn
 }
+
+//HeaderRule is a condition on the headers of a request. Rules can be combined with And, Or and Not.
+type HeaderRule func(header http.Header) bool
+
+//ValueMatcher is a condition on a single header value
+type ValueMatcher func(value string) bool
+
+//HeadersPresent is satisfied if all required headers are present with all of their values, as in FilterHeaders
+func HeadersPresent(required http.Header) HeaderRule {
+	return func(header http.Header) bool {
+		return AllHeadersPresent(required, header)
+	}
+}
+
+//HeaderPresent is satisfied if the header is present, regardless of its value
+func HeaderPresent(name string) HeaderRule {
+	return func(header http.Header) bool {
+		return len(header.Values(name)) > 0
+	}
+}
+
+//HeaderAbsent is satisfied if the header is not present
+func HeaderAbsent(name string) HeaderRule {
+	return HeaderPresent(name).Not()
+}
+
+//HeaderMatches is satisfied if any value of the header matches:
+//  middleware.HeaderMatches("X-Environment", middleware.ValueEqualsFold("staging", "production"))
+func HeaderMatches(name string, matcher ValueMatcher) HeaderRule {
+	return func(header http.Header) bool {
+		for _, value := range header.Values(name) {
+			if matcher(value) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//HeaderNoneOf is satisfied if no value of the header matches, including if the header is absent
+func HeaderNoneOf(name string, matcher ValueMatcher) HeaderRule {
+	return HeaderMatches(name, matcher).Not()
+}
+
+//And returns a rule that is satisfied if rule and all others are satisfied
+func (rule HeaderRule) And(others ...HeaderRule) HeaderRule {
+	return func(header http.Header) bool {
+		if !rule(header) {
+			return false
+		}
+		for _, other := range others {
+			if !other(header) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+//Or returns a rule that is satisfied if rule or any of the others is satisfied
+func (rule HeaderRule) Or(others ...HeaderRule) HeaderRule {
+	return func(header http.Header) bool {
+		if rule(header) {
+			return true
+		}
+		for _, other := range others {
+			if other(header) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//Not returns a rule that is satisfied if rule is not
+func (rule HeaderRule) Not() HeaderRule {
+	return func(header http.Header) bool {
+		return !rule(header)
+	}
+}
+
+//ValueEquals matches values equal to any of the given values
+func ValueEquals(values ...string) ValueMatcher {
+	return func(value string) bool {
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//ValueEqualsFold matches values equal to any of the given values, ignoring case
+func ValueEqualsFold(values ...string) ValueMatcher {
+	return func(value string) bool {
+		return containsFold(values, value)
+	}
+}
+
+//ValuePrefix matches values starting with any of the given prefixes
+func ValuePrefix(prefixes ...string) ValueMatcher {
+	return func(value string) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(value, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//ValuePrefixFold matches values starting with any of the given prefixes, ignoring case
+func ValuePrefixFold(prefixes ...string) ValueMatcher {
+	return func(value string) bool {
+		for _, prefix := range prefixes {
+			if len(value) >= len(prefix) && strings.EqualFold(value[:len(prefix)], prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//ValueGlob matches values matching any of the given patterns, in which * matches any sequence of characters
+//and ? matches a single character:
+//  middleware.ValueGlob("curl/*", "Wget/1.2?.*")
+func ValueGlob(patterns ...string) ValueMatcher {
+	return valueRegexps(globToRegexp(patterns, false))
+}
+
+//ValueGlobFold works like ValueGlob, but ignores case
+func ValueGlobFold(patterns ...string) ValueMatcher {
+	return valueRegexps(globToRegexp(patterns, true))
+}
+
+//ValueRegexp matches values matching any of the given regular expressions. It panics if an expression is invalid.
+//Use the flag (?i) for case-insensitive matching:
+//  middleware.ValueRegexp(`^GitHub-Hookshot/[0-9a-f]+$`)
+func ValueRegexp(expressions ...string) ValueMatcher {
+	var compiled []*regexp.Regexp
+	for _, expression := range expressions {
+		re, err := regexp.Compile(expression)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to compile header value expression %s", err))
+		}
+		compiled = append(compiled, re)
+	}
+	return valueRegexps(compiled)
+}
+
+func valueRegexps(expressions []*regexp.Regexp) ValueMatcher {
+	return func(value string) bool {
+		for _, re := range expressions {
+			if re.MatchString(value) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func globToRegexp(patterns []string, ignoreCase bool) []*regexp.Regexp {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		var expression strings.Builder
+		if ignoreCase {
+			expression.WriteString("(?i)")
+		}
+		expression.WriteString("^")
+		for _, c := range pattern {
+			switch c {
+			case '*':
+				expression.WriteString(".*")
+			case '?':
+				expression.WriteString(".")
+			default:
+				expression.WriteString(regexp.QuoteMeta(string(c)))
+			}
+		}
+		expression.WriteString("$")
+		compiled = append(compiled, regexp.MustCompile(expression.String()))
+	}
+	return compiled
+}
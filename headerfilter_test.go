@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -40,3 +41,90 @@ func TestAllHeadersPresent(t *testing.T) {
 		})
 	}
 }
+
+func TestHeaderRules(t *testing.T) {
+	github := http.Header{"User-Agent": {"GitHub-Hookshot/f9c1b4e"}, "X-Github-Event": {"push"}}
+	debug := http.Header{"User-Agent": {"curl/7.68.0"}, "X-Debug": {"1"}}
+	multipleValues := http.Header{"Accept": {"text/html", "application/json"}}
+
+	fromGitHub := HeaderMatches("User-Agent", ValueRegexp(`^GitHub-Hookshot/`))
+
+	tests := []struct {
+		name   string
+		rule   HeaderRule
+		header http.Header
+		want   bool
+	}{
+		{"present", HeaderPresent("x-debug"), debug, true},
+		{"present missing", HeaderPresent("X-Debug"), github, false},
+		{"absent", HeaderAbsent("X-Debug"), github, true},
+		{"absent present", HeaderAbsent("X-Debug"), debug, false},
+		{"equals any of", HeaderMatches("X-Github-Event", ValueEquals("ping", "push")), github, true},
+		{"equals is case-sensitive", HeaderMatches("X-Github-Event", ValueEquals("PUSH")), github, false},
+		{"equals fold", HeaderMatches("X-Github-Event", ValueEqualsFold("PUSH")), github, true},
+		{"equals missing header", HeaderMatches("X-Github-Event", ValueEquals("push")), debug, false},
+		{"any of multiple values", HeaderMatches("Accept", ValueEquals("application/json")), multipleValues, true},
+		{"none of", HeaderNoneOf("X-Github-Event", ValueEquals("ping")), github, true},
+		{"none of matching", HeaderNoneOf("X-Github-Event", ValueEquals("ping", "push")), github, false},
+		{"none of missing header", HeaderNoneOf("X-Github-Event", ValueEquals("push")), debug, true},
+		{"prefix", HeaderMatches("User-Agent", ValuePrefix("curl/")), debug, true},
+		{"prefix fold", HeaderMatches("User-Agent", ValuePrefixFold("github-hookshot/")), github, true},
+		{"prefix fold too short", HeaderMatches("User-Agent", ValuePrefixFold("curl/7.68.0.1")), debug, false},
+		{"glob", HeaderMatches("User-Agent", ValueGlob("curl/7.*")), debug, true},
+		{"glob single character", HeaderMatches("User-Agent", ValueGlob("curl/?.68.0")), debug, true},
+		{"glob is anchored", HeaderMatches("User-Agent", ValueGlob("7.68*")), debug, false},
+		{"glob quotes special characters", HeaderMatches("User-Agent", ValueGlob("curl/7+68*")), debug, false},
+		{"glob fold", HeaderMatches("User-Agent", ValueGlobFold("CURL/*")), debug, true},
+		{"regexp", fromGitHub, github, true},
+		{"regexp not matching", fromGitHub, debug, false},
+		{"regexp ignore case", HeaderMatches("User-Agent", ValueRegexp(`(?i)^github-`)), github, true},
+		{"headers present", HeadersPresent(http.Header{"X-Github-Event": {"push"}}), github, true},
+		{"and", fromGitHub.And(HeaderAbsent("X-Debug")), github, true},
+		{"and one failing", fromGitHub.And(HeaderAbsent("X-Debug"), HeaderPresent("X-Hub-Signature")), github, false},
+		{"or", fromGitHub.Or(HeaderMatches("User-Agent", ValuePrefix("curl/"))), debug, true},
+		{"or none satisfied", fromGitHub.Or(HeaderPresent("X-Hub-Signature")), debug, false},
+		{"nested groups", fromGitHub.Or(HeaderPresent("X-Debug").And(HeaderMatches("X-Debug", ValueEquals("1")))), debug, true},
+		{"not", fromGitHub.Not(), debug, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule(tt.header); got != tt.want {
+				t.Errorf("HeaderRule() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterHeaderRules(t *testing.T) {
+	rule := HeaderMatches("User-Agent", ValuePrefix("GitHub-Hookshot/")).And(HeaderAbsent("X-Debug"))
+	handler := FilterHeaderRules(rule)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{"permitted", http.Header{"User-Agent": {"GitHub-Hookshot/f9c1b4e"}}, 200},
+		{"debug header set", http.Header{"User-Agent": {"GitHub-Hookshot/f9c1b4e"}, "X-Debug": {"1"}}, 403},
+		{"other user agent", http.Header{"User-Agent": {"curl/7.68.0"}}, 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/", nil)
+			request.Header = tt.header
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != tt.want {
+				t.Errorf("FilterHeaderRules() status = %d, want %d", recorder.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestValueRegexp_invalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("ValueRegexp() with invalid expression should panic")
+		}
+	}()
+	ValueRegexp("(")
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha1"
 	"crypto/sha256"
@@ -9,7 +10,6 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -19,6 +19,7 @@ import (
 type hmacFilter struct {
 	next     http.Handler
 	validate func(*http.Request, []byte) (bool, error)
+	keyID    string
 }
 
 type HmacParams struct {
@@ -29,25 +30,28 @@ type HmacParams struct {
 	TimeSource  string
 	Encoding    string
 	IncludeURL  bool
+	KeyID       string //identifies the secret, published as Subject of the Principal
 }
 
 func (hm hmacFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		log.Printf("Could not read request from IP %s to %s", r.RemoteAddr, r.URL)
-		w.WriteHeader(403)
+		WriteError(w, r, &DeniedError{Status: 403, Filter: "hmac", Code: "unreadable_body", Reason: fmt.Sprintf("could not read request: %v", err)})
 		return
 	}
 	r.Body = ioutil.NopCloser(bytes.NewBuffer(body))
 	valid, err := hm.validate(r, body)
 	if err != nil {
-		log.Printf("error validating HMAC for request from IP %s to %s: %v", r.RemoteAddr, r.URL, err)
+		WriteError(w, r, &DeniedError{Status: 403, Filter: "hmac", Code: "invalid_signature", Reason: fmt.Sprintf("error validating HMAC: %v", err)})
+		return
 	}
 	if valid {
-		hm.next.ServeHTTP(w, r)
+		principal := Principal{Subject: hm.keyID, Method: "hmac"}
+		ctx := context.WithValue(r.Context(), principalKey, principal)
+		recordPrincipal(ctx, principal)
+		hm.next.ServeHTTP(w, r.WithContext(ctx))
 	} else {
-		w.WriteHeader(403)
-		log.Printf("IP %s is not permitted to access %s : invalid HMAC: \n", r.RemoteAddr, r.URL)
+		WriteError(w, r, &DeniedError{Status: 403, Filter: "hmac", Code: "invalid_signature", Reason: "invalid HMAC"})
 	}
 }
 
@@ -65,7 +69,7 @@ func HmacFilter(params HmacParams) func(http.Handler) http.Handler {
 		}
 	}
 	fn := func(next http.Handler) http.Handler {
-		return hmacFilter{next, validateFn}
+		return hmacFilter{next, validateFn, params.KeyID}
 	}
 	return fn
 }
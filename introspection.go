@@ -0,0 +1,237 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+//IntrospectionParams configures IntrospectionFilter.
+//Tokens are sent to the OAuth 2.0 token introspection Endpoint (RFC 7662), authenticated with ClientID and
+//ClientSecret if set. Requests to the endpoint are made with Client (default http.DefaultClient) and abort
+//after Timeout (default 5 seconds). If the endpoint cannot be reached or returns an error, requests are denied.
+//The token must be active and have all of the Scopes.
+//Results are cached for CacheTTL (default 1 minute), but active tokens not beyond their expiry.
+//At most MaxEntries results (default 10000) are cached.
+type IntrospectionParams struct {
+	Endpoint     string
+	ClientID     string
+	ClientSecret string
+	Client       *http.Client
+	Timeout      time.Duration
+	Scopes       []string
+	CacheTTL     time.Duration
+	MaxEntries   int
+}
+
+//TokenIntrospection is the response of a token introspection endpoint
+type TokenIntrospection struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  audience `json:"aud,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+}
+
+//Scopes returns the space separated scopes of the token
+func (ti TokenIntrospection) Scopes() []string {
+	return strings.Fields(ti.Scope)
+}
+
+//audience is a list of audiences that is encoded as a single string in JSON if it has only one element
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return fmt.Errorf("invalid audience: %s", data)
+	}
+	*a = multiple
+	return nil
+}
+
+func (a audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+type introspectionFilter struct {
+	next   http.Handler
+	params IntrospectionParams
+	cache  *introspectionCache
+}
+
+func (inf introspectionFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := bearerToken(r.Header.Get("Authorization"))
+	if token == "" {
+		w.Header().Set("WWW-Authenticate", bearerChallenge(token))
+		WriteError(w, r, &DeniedError{Status: 401, Filter: "introspection", Code: "missing_token", Reason: "bearer token missing"})
+		return
+	}
+	introspection, err := inf.introspect(r.Context(), token)
+	if err != nil {
+		WriteError(w, r, &DeniedError{Status: 503, Filter: "introspection", Code: "introspection_failed", Reason: fmt.Sprintf("token introspection failed: %v", err)})
+		return
+	}
+	if !introspection.Active {
+		w.Header().Set("WWW-Authenticate", bearerChallenge(token))
+		WriteError(w, r, &DeniedError{Status: 401, Filter: "introspection", Code: "inactive_token", Reason: "token is not active"})
+		return
+	}
+	scopes := introspection.Scopes()
+	for _, scope := range inf.params.Scopes {
+		if !contains(scopes, scope) {
+			WriteError(w, r, &DeniedError{Status: 403, Filter: "introspection", Code: "missing_scope", Reason: "token lacks scope " + scope})
+			return
+		}
+	}
+	inf.next.ServeHTTP(w, withIdentity(r, introspectionKey, introspection, introspectionPrincipal(introspection)))
+}
+
+func (inf introspectionFilter) introspect(ctx context.Context, token string) (TokenIntrospection, error) {
+	// tokens are only kept in the cache as hash
+	key := sha256.Sum256([]byte(token))
+	if introspection, ok := inf.cache.get(key); ok {
+		return introspection, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, inf.params.Timeout)
+	defer cancel()
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	request, err := http.NewRequestWithContext(ctx, "POST", inf.params.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return TokenIntrospection{}, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if inf.params.ClientID != "" {
+		request.SetBasicAuth(url.QueryEscape(inf.params.ClientID), url.QueryEscape(inf.params.ClientSecret))
+	}
+	response, err := inf.params.Client.Do(request)
+	if err != nil {
+		return TokenIntrospection{}, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, response.Body)
+		return TokenIntrospection{}, fmt.Errorf("introspection endpoint returned status %d", response.StatusCode)
+	}
+	var introspection TokenIntrospection
+	if err := json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&introspection); err != nil {
+		return TokenIntrospection{}, fmt.Errorf("invalid introspection response: %w", err)
+	}
+
+	now := inf.cache.now()
+	ttl := inf.params.CacheTTL
+	if introspection.Active && introspection.ExpiresAt != 0 {
+		expiresAt := time.Unix(introspection.ExpiresAt, 0)
+		if !expiresAt.After(now) {
+			introspection = TokenIntrospection{}
+		} else if expiresAt.Sub(now) < ttl {
+			ttl = expiresAt.Sub(now)
+		}
+	}
+	inf.cache.add(key, introspection, now.Add(ttl))
+	return introspection, nil
+}
+
+//IntrospectionFromContext returns the introspection result of the token accepted by IntrospectionFilter
+func IntrospectionFromContext(ctx context.Context) (TokenIntrospection, bool) {
+	introspection, ok := ctx.Value(introspectionKey).(TokenIntrospection)
+	return introspection, ok
+}
+
+//IntrospectionFilter permits requests with an opaque bearer token that is active according to the
+//token introspection endpoint of the authorization server. Requests without an active token are answered with
+//401 Unauthorized and a Bearer challenge, tokens that lack one of the Scopes with 403 Forbidden.
+//The introspection result is available to the following handlers with IntrospectionFromContext:
+//  requireToken := middleware.IntrospectionFilter(middleware.IntrospectionParams{
+//  	Endpoint:     "https://auth.example.org/oauth2/introspect",
+//  	ClientID:     "orders-api",
+//  	ClientSecret: os.Getenv("INTROSPECTION_SECRET"),
+//  	Scopes:       []string{"orders:read"},
+//  })
+//Requests are denied with status 503 if the introspection endpoint fails.
+func IntrospectionFilter(params IntrospectionParams) func(http.Handler) http.Handler {
+	if params.Client == nil {
+		params.Client = http.DefaultClient
+	}
+	if params.Timeout <= 0 {
+		params.Timeout = 5 * time.Second
+	}
+	if params.CacheTTL <= 0 {
+		params.CacheTTL = time.Minute
+	}
+	if params.MaxEntries <= 0 {
+		params.MaxEntries = 10000
+	}
+	cache := newIntrospectionCache(params.MaxEntries)
+	fn := func(next http.Handler) http.Handler {
+		return introspectionFilter{next, params, cache}
+	}
+	return fn
+}
+
+//introspectionCache keeps at most maxEntries introspection results in least recently used order
+type introspectionCache struct {
+	mutex   sync.Mutex
+	results *lruCache
+	now     func() time.Time
+}
+
+type introspectionEntry struct {
+	introspection TokenIntrospection
+	expires       time.Time
+}
+
+func newIntrospectionCache(maxEntries int) *introspectionCache {
+	expires := func(entry interface{}) time.Time { return entry.(introspectionEntry).expires }
+	return &introspectionCache{
+		results: newLRUCache(maxEntries, expires),
+		now:     time.Now,
+	}
+}
+
+func (c *introspectionCache) get(key [sha256.Size]byte) (TokenIntrospection, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.results.get(key, c.now())
+	if !ok {
+		return TokenIntrospection{}, false
+	}
+	return entry.(introspectionEntry).introspection, true
+}
+
+func (c *introspectionCache) add(key [sha256.Size]byte, introspection TokenIntrospection, expires time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.results.add(key, introspectionEntry{introspection, expires}, c.now())
+}
+
+func (c *introspectionCache) len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.results.len()
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestIntrospectionServer(t *testing.T, tokens map[string]TokenIntrospection) (*httptest.Server, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if id, secret, _ := r.BasicAuth(); id != "orders-api" || secret != "s3cret" {
+			w.WriteHeader(401)
+			return
+		}
+		token := r.PostFormValue("token")
+		if token == "slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		if token == "broken" {
+			w.WriteHeader(500)
+			return
+		}
+		json.NewEncoder(w).Encode(tokens[token])
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestIntrospectionFilter(t *testing.T) {
+	expires := time.Now().Add(time.Hour).Unix()
+	server, _ := newTestIntrospectionServer(t, map[string]TokenIntrospection{
+		"reader":  {Active: true, Scope: "orders:read", Subject: "alice", Audience: audience{"orders"}, ExpiresAt: expires},
+		"writer":  {Active: true, Scope: "orders:read orders:write", Subject: "bob", ExpiresAt: expires},
+		"expired": {Active: true, Scope: "orders:read", Subject: "carol", ExpiresAt: time.Now().Add(-time.Minute).Unix()},
+		"revoked": {Active: false},
+	})
+	params := IntrospectionParams{Endpoint: server.URL, ClientID: "orders-api", ClientSecret: "s3cret", Timeout: 100 * time.Millisecond}
+	withScopes := params
+	withScopes.Scopes = []string{"orders:write"}
+	wrongSecret := params
+	wrongSecret.ClientSecret = "guess"
+
+	tests := []struct {
+		name        string
+		params      IntrospectionParams
+		token       string
+		want        int
+		wantSubject string
+	}{
+		{"active token", params, "reader", 200, "alice"},
+		{"required scope", withScopes, "writer", 200, "bob"},
+		{"missing scope", withScopes, "reader", 403, ""},
+		{"inactive token", params, "revoked", 401, ""},
+		{"unknown token", params, "unknown", 401, ""},
+		{"expired token", params, "expired", 401, ""},
+		{"missing token", params, "", 401, ""},
+		{"endpoint error", params, "broken", 503, ""},
+		{"endpoint timeout", params, "slow", 503, ""},
+		{"client authentication failed", wrongSecret, "reader", 503, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var introspection TokenIntrospection
+			handler := IntrospectionFilter(tt.params)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				introspection, _ = IntrospectionFromContext(r.Context())
+			}))
+			request := httptest.NewRequest("GET", "/", nil)
+			if tt.token != "" {
+				request.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != tt.want {
+				t.Errorf("IntrospectionFilter() status = %d, want %d", recorder.Code, tt.want)
+			}
+			wantChallenge := `Bearer error="invalid_token"`
+			if tt.token == "" {
+				wantChallenge = "Bearer"
+			}
+			if challenge := recorder.Header().Get("WWW-Authenticate"); tt.want == 401 && challenge != wantChallenge {
+				t.Errorf("IntrospectionFilter() challenge = %s, want %s", challenge, wantChallenge)
+			}
+			if introspection.Subject != tt.wantSubject {
+				t.Errorf("IntrospectionFromContext() subject = %s, want %s", introspection.Subject, tt.wantSubject)
+			}
+		})
+	}
+}
+
+func TestIntrospectionFilter_cache(t *testing.T) {
+	now := time.Now()
+	server, calls := newTestIntrospectionServer(t, map[string]TokenIntrospection{
+		"short":   {Active: true, ExpiresAt: now.Add(10 * time.Second).Unix()},
+		"long":    {Active: true, ExpiresAt: now.Add(time.Hour).Unix()},
+		"revoked": {Active: false},
+	})
+	params := IntrospectionParams{Endpoint: server.URL, ClientID: "orders-api", ClientSecret: "s3cret", CacheTTL: time.Minute, MaxEntries: 3}
+	filter := IntrospectionFilter(params)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).(introspectionFilter)
+	filter.cache.now = func() time.Time { return now }
+
+	request := func(token string, wantCalls int32) {
+		t.Helper()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		filter.ServeHTTP(httptest.NewRecorder(), r)
+		if got := atomic.LoadInt32(calls); got != wantCalls {
+			t.Errorf("request with token %s: %d calls to the introspection endpoint, want %d", token, got, wantCalls)
+		}
+	}
+	request("long", 1)
+	request("long", 1)
+	request("revoked", 2)
+	request("revoked", 2)
+
+	// active tokens are cached until they expire, everything else until the CacheTTL has passed
+	request("short", 3)
+	now = now.Add(20 * time.Second)
+	request("short", 4)
+	request("long", 4)
+	now = now.Add(time.Minute)
+	request("long", 5)
+	request("revoked", 6)
+
+	// least recently used results are evicted beyond MaxEntries
+	request("short", 7)
+	request("long", 7)
+	request("unknown", 8)
+	if filter.cache.len() != 3 {
+		t.Errorf("cache contains %d entries, want 3", filter.cache.len())
+	}
+	request("revoked", 9)
+	request("long", 9)
+}
@@ -2,7 +2,6 @@ package middleware
 
 import (
 	"fmt"
-	"log"
 	"net"
 	"net/http"
 	"net/textproto"
@@ -10,35 +9,46 @@ import (
 )
 
 type ipFilter struct {
-	next          http.Handler
-	permittedNets []*net.IPNet
-	ipHeader      string
+	next     http.Handler
+	list     *IPList
+	ipHeader string
 }
 
 func (ipf ipFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
-	var ip string
-	if ipf.ipHeader != "" {
-		_, ok := r.Header[ipf.ipHeader]
-		if !ok{
-			log.Printf("Required IP Header %s missing in request to %s from IP %s : Supplied headers: %v \n", ipf.ipHeader, r.URL, r.RemoteAddr, r.Header)
-			return
-		}
-		//Get returns the first value for a header. In headers with multiple values, this should be the client ip
-		ip = r.Header.Get(ipf.ipHeader)
-	} else {
-		ip = r.RemoteAddr
+	ip, ok := clientIP(r, ipf.ipHeader)
+	if !ok {
+		denyMissingIPHeader(w, r, "ip", ipf.ipHeader)
+		return
 	}
-	isPermittedIP, err := isPermittedIP(ip, ipf.permittedNets)
+	isPermittedIP, err := ipf.list.Contains(ip)
 	if err == nil && isPermittedIP {
 		ipf.next.ServeHTTP(w, r)
 	} else {
-		w.WriteHeader(403)
-		log.Printf("IP %s is not permitted to access %s \n", ip, r.URL)
+		WriteError(w, r, &DeniedError{Status: 403, Filter: "ip", Code: "ip_not_permitted", Reason: "IP not permitted", IP: ip})
 	}
 
 }
 
+//clientIP returns the address of the client that sent the request, which is the first value of ipHeader if set,
+//or the remote address of the connection otherwise. ok is false if ipHeader is set, but missing in the request.
+func clientIP(r *http.Request, ipHeader string) (ip string, ok bool) {
+	if ipHeader == "" {
+		return r.RemoteAddr, true
+	}
+	if _, ok := r.Header[ipHeader]; !ok {
+		return "", false
+	}
+	//Get returns the first value for a header. In headers with multiple values, this should be the client ip
+	return r.Header.Get(ipHeader), true
+}
+
+//denyMissingIPHeader rejects a request in which the ip header required by filter is missing. Only the name
+//of the header is logged, as the values of the other headers may contain credentials.
+func denyMissingIPHeader(w http.ResponseWriter, r *http.Request, filter string, ipHeader string) {
+	WriteError(w, r, &DeniedError{Status: 403, Filter: filter, Code: "missing_ip_header", Reason: fmt.Sprintf("required IP header %s missing", ipHeader)})
+}
+
 func isPermittedIP(remoteIP string, permittedNets []*net.IPNet) (bool, error) {
 	ip := getIpFromString(remoteIP)
 	if ip == nil {
@@ -54,13 +64,19 @@ func isPermittedIP(remoteIP string, permittedNets []*net.IPNet) (bool, error) {
 }
 
 func IPFilter(ipRanges []string, header string) func(http.Handler) http.Handler {
-	permittedNets, err := convertToIPNet(ipRanges)
+	list, err := NewIPList(ipRanges)
 	if err != nil {
 		panic(fmt.Sprintf("Failed to convert ip ranges %s", err))
 	}
+	return IPListFilter(list, header)
+}
+
+//IPListFilter works like IPFilter, but checks the client ip against an IPList whose ranges can be
+//replaced while the filter is in use, e.g. by IPList.Watch
+func IPListFilter(list *IPList, header string) func(http.Handler) http.Handler {
 	header = textproto.CanonicalMIMEHeaderKey(header)
 	fn := func(next http.Handler) http.Handler {
-		return ipFilter{next, permittedNets, header}
+		return ipFilter{next, list, header}
 	}
 	return fn
 }
@@ -101,14 +117,12 @@ func convertToIPNet(ipRanges []string) ([]*net.IPNet, error) {
 	return ipNets, nil
 }
 
+//getIpFromString parses an address with port ("192.0.2.1:1234", "[2001:db8::1]:1234") as well as
+//a bare IP ("2001:db8::1"), as found in headers like X-Real-IP
 func getIpFromString(addr string) net.IP {
-	for _, c := range "[]\"" {
-		addr = strings.ReplaceAll(addr, string(c), "")
-	}
-	colonIndex := strings.LastIndex(addr, ":")
-	if colonIndex != -1 {
-		addr = addr[:strings.LastIndex(addr, ":")]
+	addr = strings.TrimSpace(strings.ReplaceAll(addr, "\"", ""))
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
 	}
-	ip := net.ParseIP(addr)
-	return ip
+	return net.ParseIP(strings.Trim(addr, "[]"))
 }
@@ -2,7 +2,10 @@ package middleware
 
 import (
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -17,6 +20,10 @@ func Test_getIpFromString(t *testing.T) {
 		{"IPv4 in quotes", "\"127.0.0.1:1234\"", net.ParseIP("127.0.0.1")},
 		{"localhost IPv6", "[::1]:57048", net.ParseIP("::1")},
 		{"IPv6 in quotes", "\"[::1]\":57048", net.ParseIP("::1")},
+		{"bare IPv4", "192.0.2.1", net.ParseIP("192.0.2.1")},
+		{"bare IPv6", "2001:db8::1", net.ParseIP("2001:db8::1")},
+		{"bare IPv6 ending in a number", "2001:db8::1234", net.ParseIP("2001:db8::1234")},
+		{"IPv6 in brackets without port", "[2001:db8::1]", net.ParseIP("2001:db8::1")},
 		{"Invalid IP", "aabbccd", nil},
 	}
 	for _, tt := range tests {
@@ -52,6 +59,7 @@ func Test_isPermittedIP(t *testing.T) {
 		{"Loopback Mix Permitted 2", args{"127.255.0.1:12345", localhostIPv6}, true, false},
 		{"Loopback Mix IP not permitted", args{"128.0.0.1:12345", localhostIPv6}, false, false},
 		{"Loopback Mix IP not permitted", args{"126.0.0.1:12345", localhostIPv6}, false, false},
+		{"IPv6 from header", args{"::1", localhostIPv6}, true, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -97,3 +105,22 @@ func Test_convertToIPNet(t *testing.T) {
 		})
 	}
 }
+
+func TestIPFilter_missingHeader(t *testing.T) {
+	var reason string
+	errs := HandleErrors(ErrorParams{Log: func(r *http.Request, status int, err error) {
+		reason = err.Error()
+	}})
+	handler := errs(IPFilter([]string{"localhost"}, "X-Forwarded-For")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	request := httptest.NewRequest("GET", "/", nil)
+	request.RemoteAddr = "127.0.0.1:1234"
+	request.Header.Set("Authorization", "Bearer secret-token")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != 403 {
+		t.Errorf("IPFilter() without ip header: status = %d, want 403", recorder.Code)
+	}
+	if strings.Contains(reason, "secret-token") {
+		t.Errorf("IPFilter() logged header values: %s", reason)
+	}
+}
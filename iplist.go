@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//IPList is a set of permitted ip ranges that can be replaced atomically while it is used by an IPFilter,
+//e.g. to reload it from a file without restarting the server.
+type IPList struct {
+	nets atomic.Value // []*net.IPNet
+}
+
+//NewIPList creates an IPList from ip ranges in the same format as accepted by IPFilter
+func NewIPList(ipRanges []string) (*IPList, error) {
+	list := &IPList{}
+	if err := list.Replace(ipRanges); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+//LoadIPList creates an IPList from a file with one ip range per line.
+//Empty lines and everything following a # are ignored:
+//  # office network
+//  192.168.1.0/24
+//  10.0.0.1 # build server
+func LoadIPList(path string) (*IPList, error) {
+	list := &IPList{}
+	if err := list.ReplaceFromFile(path); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+//Replace atomically swaps the ip ranges of the list. If any of the ranges is invalid, the list is left unchanged.
+func (l *IPList) Replace(ipRanges []string) error {
+	permittedNets, err := convertToIPNet(ipRanges)
+	if err != nil {
+		return err
+	}
+	l.nets.Store(permittedNets)
+	return nil
+}
+
+//ReplaceFromFile atomically swaps the ip ranges of the list with the ones read from a file in the format
+//described for LoadIPList. If the file cannot be read or is invalid, the list is left unchanged.
+func (l *IPList) ReplaceFromFile(path string) error {
+	ipRanges, err := readIPRanges(path)
+	if err != nil {
+		return err
+	}
+	if err := l.Replace(ipRanges); err != nil {
+		return fmt.Errorf("invalid ip range in %s: %w", path, err)
+	}
+	return nil
+}
+
+//Contains reports whether the ip address (with or without port) is part of one of the ranges in the list
+func (l *IPList) Contains(ip string) (bool, error) {
+	return isPermittedIP(ip, l.permittedNets())
+}
+
+//Watch checks the file at path for modifications every interval and replaces the ranges of the list
+//with the content of the file whenever it has changed. If the changed file is invalid, the previous ranges
+//are kept and an error is logged. Watching stops when the returned function is called.
+//An interval of zero or less defaults to 10 seconds.
+//The file should be replaced atomically (e.g. written to a temporary file and renamed), otherwise
+//a partially written file may be loaded.
+//  list, err := middleware.LoadIPList("/etc/allowlist.txt")
+//  stop := list.Watch("/etc/allowlist.txt", 10*time.Second)
+//  defer stop()
+//  mux.Handle("/endpoint", middleware.IPListFilter(list, "")(handler))
+func (l *IPList) Watch(path string, interval time.Duration) (stop func()) {
+	return watchFile(path, interval, func() {
+		if err := l.ReplaceFromFile(path); err != nil {
+			log.Printf("Failed to reload ip list, keeping previous ranges: %v \n", err)
+		}
+	})
+}
+
+//watchFile calls reload whenever the modification time or size of the file at path has changed,
+//checking every interval until the returned function is called. An interval of zero or less defaults to 10 seconds.
+func watchFile(path string, interval time.Duration, reload func()) (stop func()) {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	lastModified, lastSize := fileVersion(path)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer close(stopped)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				modified, size := fileVersion(path)
+				if modified.Equal(lastModified) && size == lastSize {
+					continue
+				}
+				lastModified, lastSize = modified, size
+				reload()
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+}
+
+func (l *IPList) permittedNets() []*net.IPNet {
+	permittedNets, _ := l.nets.Load().([]*net.IPNet)
+	return permittedNets
+}
+
+func fileVersion(path string) (time.Time, int64) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, -1
+	}
+	return info.ModTime(), info.Size()
+}
+
+func readIPRanges(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var ipRanges []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if commentIndex := strings.Index(line, "#"); commentIndex != -1 {
+			line = line[:commentIndex]
+		}
+		line = strings.TrimSpace(line)
+		if line != "" {
+			ipRanges = append(ipRanges, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ipRanges, nil
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_readIPRanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"single range", "192.168.1.0/24\n", []string{"192.168.1.0/24"}},
+		{"comments and empty lines", "# office\n\n192.168.1.0/24\n  # indented comment\n", []string{"192.168.1.0/24"}},
+		{"trailing comment", "10.0.0.1 # build server\n::1/128#loopback", []string{"10.0.0.1", "::1/128"}},
+		{"only comments", "# nothing here\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "allowlist.txt")
+			if err := ioutil.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readIPRanges(path)
+			if err != nil {
+				t.Fatalf("readIPRanges() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readIPRanges() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPList_Replace(t *testing.T) {
+	list, err := NewIPList([]string{"192.168.1.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := list.Replace([]string{"10.0.0.0/8", "abcdefg"}); err == nil {
+		t.Errorf("Replace() with invalid range: expected error")
+	}
+	if ok, _ := list.Contains("192.168.1.5:1234"); !ok {
+		t.Errorf("Contains() after invalid Replace: previous ranges should be kept")
+	}
+	if err := list.Replace([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+	if ok, _ := list.Contains("192.168.1.5:1234"); ok {
+		t.Errorf("Contains() after Replace: old range should be removed")
+	}
+	if ok, _ := list.Contains("10.1.2.3:1234"); !ok {
+		t.Errorf("Contains() after Replace: new range should be permitted")
+	}
+}
+
+func TestIPList_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowlist.txt")
+	modified := time.Now().Add(-time.Hour)
+	writeFile := func(content string) {
+		tmp := path + ".tmp"
+		if err := ioutil.WriteFile(tmp, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		modified = modified.Add(time.Minute)
+		if err := os.Chtimes(tmp, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeFile("192.168.1.0/24\n")
+	list, err := LoadIPList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := list.Watch(path, 5*time.Millisecond)
+	defer stop()
+
+	waitFor := func(ip string, want bool) {
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if ok, _ := list.Contains(ip); ok == want {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("Contains(%s) did not become %v", ip, want)
+	}
+
+	writeFile("10.0.0.0/8\n")
+	waitFor("10.1.2.3:1234", true)
+	waitFor("192.168.1.5:1234", false)
+
+	writeFile("10.0.0.0/8\nnot an ip\n")
+	time.Sleep(50 * time.Millisecond)
+	if ok, _ := list.Contains("10.1.2.3:1234"); !ok {
+		t.Errorf("Contains() after invalid reload: previous ranges should be kept")
+	}
+
+	stop()
+	writeFile("192.168.1.0/24\n")
+	time.Sleep(50 * time.Millisecond)
+	if ok, _ := list.Contains("10.1.2.3:1234"); !ok {
+		t.Errorf("Contains() after stop: list should not be reloaded")
+	}
+}
+
+func TestIPList_WatchDefaultInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowlist.txt")
+	if err := ioutil.WriteFile(path, []byte("10.0.0.0/8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	list, err := LoadIPList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, interval := range []time.Duration{0, -time.Second} {
+		list.Watch(path, interval)()
+	}
+}
@@ -0,0 +1,255 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//JWK is a key used to verify the signature of a JWT.
+//Key is a []byte for HMAC, an *rsa.PublicKey, an *ecdsa.PublicKey or an ed25519.PublicKey.
+//If Algorithm is set, the key is only used for tokens signed with that algorithm.
+//If both the key and the token have a key id, the key is only used if they match.
+type JWK struct {
+	ID        string
+	Algorithm string
+	Key       interface{}
+}
+
+type jsonWebKey struct {
+	KeyType   string `json:"kty"`
+	ID        string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+	X         string `json:"x"`
+	Y         string `json:"y"`
+	K         string `json:"k"`
+}
+
+//ParseJWKS parses a JSON Web Key Set (RFC 7517) as published at the jwks_uri of an identity provider.
+//Keys that are not meant for signatures ("use": "enc") are skipped.
+func ParseJWKS(data []byte) ([]JWK, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+	var keys []JWK
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s in JWKS: %w", jwk.ID, err)
+		}
+		keys = append(keys, JWK{ID: jwk.ID, Algorithm: jwk.Algorithm, Key: key})
+	}
+	return keys, nil
+}
+
+//LoadJWKS reads a JSON Web Key Set from a file
+func LoadJWKS(path string) ([]JWK, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return keys, nil
+}
+
+func (jwk jsonWebKey) publicKey() (interface{}, error) {
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := decodeJWKInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeJWKInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Curve)
+		}
+		x, err := decodeJWKInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeJWKInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		if _, err := key.ECDH(); err != nil {
+			return nil, fmt.Errorf("invalid EC point")
+		}
+		return key, nil
+	case "OKP":
+		if jwk.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	case "oct":
+		k, err := base64.RawURLEncoding.DecodeString(jwk.K)
+		if err != nil || len(k) == 0 {
+			return nil, fmt.Errorf("invalid symmetric key")
+		}
+		return k, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", jwk.KeyType)
+	}
+}
+
+func decodeJWKInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+//JWKSFetcher retrieves a JSON Web Key Set, e.g. from the jwks_uri of an identity provider
+type JWKSFetcher interface {
+	FetchJWKS(ctx context.Context) ([]byte, error)
+}
+
+//JWKSFetcherFunc is an adapter to use a function as JWKSFetcher
+type JWKSFetcherFunc func(ctx context.Context) ([]byte, error)
+
+//FetchJWKS calls f(ctx)
+func (f JWKSFetcherFunc) FetchJWKS(ctx context.Context) ([]byte, error) {
+	return f(ctx)
+}
+
+//JWKSFile returns a JWKSFetcher that reads the key set from a file
+func JWKSFile(path string) JWKSFetcher {
+	return JWKSFetcherFunc(func(ctx context.Context) ([]byte, error) {
+		return ioutil.ReadFile(path)
+	})
+}
+
+//minimum time between two refreshes triggered by tokens with an unknown key id
+const jwksMinRefreshInterval = time.Minute
+
+//JWKSet is a JSON Web Key Set that is refreshed from a JWKSFetcher, so that keys rotated by the identity
+//provider are picked up without restarting the server. The keys are refreshed when they are older than
+//the refresh interval, and when a token with an unknown key id arrives (at most once per minute).
+//If a refresh fails, the previous keys are kept.
+type JWKSet struct {
+	fetcher  JWKSFetcher
+	interval time.Duration
+	keys     atomic.Value // []JWK
+	mutex    sync.Mutex
+	fetched  atomic.Int64 // unix nanoseconds of the last refresh
+	now      func() time.Time
+}
+
+//NewJWKSet creates a JWKSet and fetches the initial keys
+//  keys, err := middleware.NewJWKSet(middleware.JWKSFile("/etc/service/jwks.json"), time.Hour)
+//  requireToken := middleware.JWTFilter(middleware.JWTParams{KeySet: keys, Issuers: []string{"https://id.example.org"}})
+func NewJWKSet(fetcher JWKSFetcher, refreshInterval time.Duration) (*JWKSet, error) {
+	set := &JWKSet{fetcher: fetcher, interval: refreshInterval, now: time.Now}
+	set.keys.Store([]JWK(nil))
+	if err := set.Refresh(context.Background()); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+//Refresh fetches the keys and replaces the current ones. If the keys cannot be fetched or are invalid,
+//the current keys are left unchanged.
+func (s *JWKSet) Refresh(ctx context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.refresh(ctx)
+}
+
+func (s *JWKSet) refresh(ctx context.Context) error {
+	s.fetched.Store(s.now().UnixNano())
+	data, err := s.fetcher.FetchJWKS(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return err
+	}
+	s.keys.Store(keys)
+	return nil
+}
+
+//Keys returns the current keys
+func (s *JWKSet) Keys() []JWK {
+	return s.keys.Load().([]JWK)
+}
+
+//keysFor returns the current keys, refreshing them first if they are stale or if none of them has the key id
+func (s *JWKSet) keysFor(ctx context.Context, id string) ([]JWK, error) {
+	keys := s.Keys()
+	if !s.needsRefresh(keys, id) {
+		return keys, nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// another request may have refreshed the keys while waiting for the lock
+	keys = s.Keys()
+	if !s.needsRefresh(keys, id) {
+		return keys, nil
+	}
+	if err := s.refresh(ctx); err != nil {
+		return keys, err
+	}
+	return s.Keys(), nil
+}
+
+func (s *JWKSet) needsRefresh(keys []JWK, id string) bool {
+	sinceFetch := s.now().Sub(time.Unix(0, s.fetched.Load()))
+	if s.interval > 0 && sinceFetch >= s.interval {
+		return true
+	}
+	return id != "" && !hasKeyID(keys, id) && sinceFetch >= jwksMinRefreshInterval
+}
+
+func hasKeyID(keys []JWK, id string) bool {
+	for _, key := range keys {
+		if key.ID == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func testJWKS(keys testSigningKeys, rsaID string) string {
+	encode := func(b []byte) string {
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	return fmt.Sprintf(`{"keys": [
+		{"kty": "RSA", "kid": "%s", "alg": "RS256", "use": "sig", "n": "%s", "e": "%s"},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": "%s", "y": "%s"},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": "%s"},
+		{"kty": "oct", "kid": "hmac", "k": "%s"},
+		{"kty": "RSA", "kid": "encryption", "use": "enc", "n": "AQAB", "e": "AQAB"}
+	]}`, rsaID, encode(keys.rsa.N.Bytes()), encode(big.NewInt(int64(keys.rsa.E)).Bytes()),
+		encode(keys.ecdsa.X.FillBytes(make([]byte, 32))), encode(keys.ecdsa.Y.FillBytes(make([]byte, 32))),
+		encode(keys.ed25519.Public().(ed25519.PublicKey)), encode(keys.secret))
+}
+
+func TestParseJWKS(t *testing.T) {
+	keys := newTestSigningKeys(t)
+	parsed, err := ParseJWKS([]byte(testJWKS(keys, "rsa")))
+	if err != nil {
+		t.Fatalf("ParseJWKS() error = %v", err)
+	}
+	if len(parsed) != 4 {
+		t.Fatalf("ParseJWKS() returned %d keys, want 4", len(parsed))
+	}
+	if key, ok := parsed[0].Key.(*rsa.PublicKey); !ok || !key.Equal(&keys.rsa.PublicKey) || parsed[0].Algorithm != "RS256" {
+		t.Errorf("ParseJWKS() RSA key = %+v", parsed[0])
+	}
+	if key, ok := parsed[1].Key.(*ecdsa.PublicKey); !ok || !key.Equal(&keys.ecdsa.PublicKey) {
+		t.Errorf("ParseJWKS() EC key = %+v", parsed[1])
+	}
+	if key, ok := parsed[2].Key.(ed25519.PublicKey); !ok || !key.Equal(keys.ed25519.Public()) {
+		t.Errorf("ParseJWKS() OKP key = %+v", parsed[2])
+	}
+	if key, ok := parsed[3].Key.([]byte); !ok || string(key) != string(keys.secret) {
+		t.Errorf("ParseJWKS() oct key = %+v", parsed[3])
+	}
+
+	invalid := []string{
+		`not json`,
+		`{"keys": [{"kty": "EC", "crv": "P-256", "x": "AQAB", "y": "AQAB"}]}`,
+		`{"keys": [{"kty": "EC", "crv": "secp256k1", "x": "AQAB", "y": "AQAB"}]}`,
+		`{"keys": [{"kty": "OKP", "crv": "Ed25519", "x": "AQAB"}]}`,
+		`{"keys": [{"kty": "RSA", "n": "", "e": "AQAB"}]}`,
+		`{"keys": [{"kty": "unknown"}]}`,
+	}
+	for _, jwks := range invalid {
+		if _, err := ParseJWKS([]byte(jwks)); err == nil {
+			t.Errorf("ParseJWKS(%s) expected error", jwks)
+		}
+	}
+}
+
+func TestJWKSet(t *testing.T) {
+	keys := newTestSigningKeys(t)
+	document := testJWKS(keys, "rsa-1")
+	fetches := 0
+	var fetchErr error
+	fetcher := JWKSFetcherFunc(func(ctx context.Context) ([]byte, error) {
+		fetches++
+		return []byte(document), fetchErr
+	})
+	set, err := NewJWKSet(fetcher, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	set.now = func() time.Time { return now }
+
+	if _, err := set.keysFor(context.Background(), "rsa-1"); err != nil || fetches != 1 {
+		t.Errorf("keysFor() with known key id: fetches = %d, err = %v", fetches, err)
+	}
+
+	// the identity provider rotates its key, but unknown key ids only trigger a refresh once per minute
+	document = testJWKS(keys, "rsa-2")
+	if found, _ := set.keysFor(context.Background(), "rsa-2"); hasKeyID(found, "rsa-2") || fetches != 1 {
+		t.Errorf("keysFor() refreshed too early: fetches = %d", fetches)
+	}
+	now = now.Add(jwksMinRefreshInterval)
+	if found, _ := set.keysFor(context.Background(), "rsa-2"); !hasKeyID(found, "rsa-2") || fetches != 2 {
+		t.Errorf("keysFor() with unknown key id: fetches = %d", fetches)
+	}
+
+	// stale keys are refreshed, and kept if the refresh fails
+	fetchErr = errors.New("unavailable")
+	now = now.Add(time.Hour)
+	found, err := set.keysFor(context.Background(), "rsa-2")
+	if err == nil || !hasKeyID(found, "rsa-2") || fetches != 3 {
+		t.Errorf("keysFor() with failing refresh: fetches = %d, err = %v", fetches, err)
+	}
+
+	if _, err := NewJWKSet(fetcher, time.Hour); err == nil {
+		t.Errorf("NewJWKSet() with failing fetcher: expected error")
+	}
+}
+
+func TestJWTFilter_keySet(t *testing.T) {
+	keys := newTestSigningKeys(t)
+	set, err := NewJWKSet(JWKSFile(writeTestFile(t, "jwks.json", testJWKS(keys, "rsa"))), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}
+	params := JWTParams{KeySet: set}
+	filter := jwtFilter{params: params, algorithms: map[string]bool{"RS256": true, "ES256": true, "PS256": true}, now: time.Now}
+
+	tests := []struct {
+		name    string
+		header  map[string]interface{}
+		wantErr bool
+	}{
+		{"RS256", map[string]interface{}{"alg": "RS256", "kid": "rsa"}, false},
+		{"ES256", map[string]interface{}{"alg": "ES256", "kid": "ec"}, false},
+		{"algorithm of key differs", map[string]interface{}{"alg": "PS256", "kid": "rsa"}, true},
+		{"unknown key id", map[string]interface{}{"alg": "RS256", "kid": "other"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := filter.validate(context.Background(), keys.sign(t, tt.header, claims))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
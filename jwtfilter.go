@@ -0,0 +1,344 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//JWTParams configures JWTFilter.
+//The signature is verified with the matching keys from Keys and KeySet. Only the Algorithms listed are
+//accepted; by default all supported algorithms are: HS256, HS384, HS512, RS256, RS384, RS512,
+//PS256, PS384, PS512, ES256, ES384, ES512 and EdDSA.
+//Tokens must have an exp claim. exp, nbf and iat are checked with the allowed clock skew Leeway.
+//If Issuers or Audiences are not empty, the iss claim must be one of the Issuers and one of the aud values
+//must be one of the Audiences.
+type JWTParams struct {
+	Keys       []JWK
+	KeySet     *JWKSet
+	Algorithms []string
+	Issuers    []string
+	Audiences  []string
+	Leeway     time.Duration
+}
+
+//JWTClaims contains the validated claims of a JWT. Raw holds all claims, including the registered ones.
+type JWTClaims struct {
+	Issuer    string
+	Subject   string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time
+	IssuedAt  time.Time
+	ID        string
+	Raw       map[string]interface{}
+}
+
+type jwtAlgorithm struct {
+	hash   crypto.Hash
+	verify func(key interface{}, hash crypto.Hash, signed []byte, signature []byte) bool
+}
+
+var jwtAlgorithms = map[string]jwtAlgorithm{
+	"HS256": {crypto.SHA256, verifyHMAC},
+	"HS384": {crypto.SHA384, verifyHMAC},
+	"HS512": {crypto.SHA512, verifyHMAC},
+	"RS256": {crypto.SHA256, verifyRSA},
+	"RS384": {crypto.SHA384, verifyRSA},
+	"RS512": {crypto.SHA512, verifyRSA},
+	"PS256": {crypto.SHA256, verifyRSAPSS},
+	"PS384": {crypto.SHA384, verifyRSAPSS},
+	"PS512": {crypto.SHA512, verifyRSAPSS},
+	"ES256": {crypto.SHA256, verifyECDSA(elliptic.P256())},
+	"ES384": {crypto.SHA384, verifyECDSA(elliptic.P384())},
+	"ES512": {crypto.SHA512, verifyECDSA(elliptic.P521())},
+	"EdDSA": {0, verifyEd25519},
+}
+
+type jwtFilter struct {
+	next       http.Handler
+	params     JWTParams
+	algorithms map[string]bool
+	now        func() time.Time
+}
+
+func (jf jwtFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := bearerToken(r.Header.Get("Authorization"))
+	if token == "" {
+		w.Header().Set("WWW-Authenticate", bearerChallenge(token))
+		WriteError(w, r, &DeniedError{Status: 401, Filter: "jwt", Code: "missing_token", Reason: "bearer token missing"})
+		return
+	}
+	claims, err := jf.validate(r.Context(), token)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", bearerChallenge(token))
+		WriteError(w, r, &DeniedError{Status: 401, Filter: "jwt", Code: "invalid_token", Reason: fmt.Sprintf("invalid JWT: %v", err)})
+		return
+	}
+	jf.next.ServeHTTP(w, withIdentity(r, jwtClaimsKey, claims, jwtPrincipal(claims)))
+}
+
+//bearerChallenge returns the WWW-Authenticate challenge of RFC 6750 for a request without an acceptable token.
+//The error is only indicated if a token was sent.
+func bearerChallenge(token string) string {
+	if token == "" {
+		return "Bearer"
+	}
+	return `Bearer error="invalid_token"`
+}
+
+func (jf jwtFilter) validate(ctx context.Context, token string) (JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return JWTClaims{}, fmt.Errorf("malformed token")
+	}
+	var header struct {
+		Algorithm string   `json:"alg"`
+		KeyID     string   `json:"kid"`
+		Critical  []string `json:"crit"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return JWTClaims{}, fmt.Errorf("invalid header: %w", err)
+	}
+	algorithm, ok := jwtAlgorithms[header.Algorithm]
+	if !ok || !jf.algorithms[header.Algorithm] {
+		return JWTClaims{}, fmt.Errorf("algorithm %q not permitted", header.Algorithm)
+	}
+	if len(header.Critical) > 0 {
+		return JWTClaims{}, fmt.Errorf("unsupported critical header parameters %v", header.Critical)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return JWTClaims{}, fmt.Errorf("invalid signature encoding")
+	}
+
+	keys := jf.params.Keys
+	if jf.params.KeySet != nil {
+		setKeys, err := jf.params.KeySet.keysFor(ctx, header.KeyID)
+		if err != nil {
+			log.Printf("Failed to refresh JWKS: %v", err)
+		}
+		keys = append(keys[:len(keys):len(keys)], setKeys...)
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, key := range keys {
+		if key.ID != "" && header.KeyID != "" && key.ID != header.KeyID {
+			continue
+		}
+		if key.Algorithm != "" && key.Algorithm != header.Algorithm {
+			continue
+		}
+		if algorithm.verify(key.Key, algorithm.hash, signed, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return JWTClaims{}, fmt.Errorf("signature verification failed")
+	}
+
+	var raw map[string]interface{}
+	if err := decodeJWTPart(parts[1], &raw); err != nil {
+		return JWTClaims{}, fmt.Errorf("invalid claims: %w", err)
+	}
+	claims, err := newJWTClaims(raw)
+	if err != nil {
+		return JWTClaims{}, err
+	}
+	return claims, jf.validateClaims(claims)
+}
+
+func (jf jwtFilter) validateClaims(claims JWTClaims) error {
+	now := jf.now()
+	leeway := jf.params.Leeway
+	if claims.ExpiresAt.IsZero() {
+		return fmt.Errorf("missing exp claim")
+	}
+	if !now.Before(claims.ExpiresAt.Add(leeway)) {
+		return fmt.Errorf("token expired at %s", claims.ExpiresAt.Format(time.RFC3339))
+	}
+	if !claims.NotBefore.IsZero() && now.Add(leeway).Before(claims.NotBefore) {
+		return fmt.Errorf("token not valid before %s", claims.NotBefore.Format(time.RFC3339))
+	}
+	if !claims.IssuedAt.IsZero() && now.Add(leeway).Before(claims.IssuedAt) {
+		return fmt.Errorf("token issued in the future at %s", claims.IssuedAt.Format(time.RFC3339))
+	}
+	if len(jf.params.Issuers) > 0 && !contains(jf.params.Issuers, claims.Issuer) {
+		return fmt.Errorf("issuer %q not permitted", claims.Issuer)
+	}
+	if len(jf.params.Audiences) > 0 {
+		permitted := false
+		for _, audience := range claims.Audience {
+			permitted = permitted || contains(jf.params.Audiences, audience)
+		}
+		if !permitted {
+			return fmt.Errorf("audience %v not permitted", claims.Audience)
+		}
+	}
+	return nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func newJWTClaims(raw map[string]interface{}) (JWTClaims, error) {
+	claims := JWTClaims{Raw: raw}
+	var err error
+	stringClaim := func(name string) string {
+		value, ok := raw[name]
+		if !ok {
+			return ""
+		}
+		s, ok := value.(string)
+		if !ok && err == nil {
+			err = fmt.Errorf("invalid %s claim", name)
+		}
+		return s
+	}
+	timeClaim := func(name string) time.Time {
+		value, ok := raw[name]
+		if !ok {
+			return time.Time{}
+		}
+		number, ok := value.(json.Number)
+		seconds, parseErr := number.Float64()
+		if (!ok || parseErr != nil || math.IsInf(seconds, 0)) && err == nil {
+			err = fmt.Errorf("invalid %s claim", name)
+			return time.Time{}
+		}
+		integer, fraction := math.Modf(seconds)
+		return time.Unix(int64(integer), int64(fraction*1e9))
+	}
+	claims.Issuer = stringClaim("iss")
+	claims.Subject = stringClaim("sub")
+	claims.ID = stringClaim("jti")
+	claims.ExpiresAt = timeClaim("exp")
+	claims.NotBefore = timeClaim("nbf")
+	claims.IssuedAt = timeClaim("iat")
+	switch audience := raw["aud"].(type) {
+	case nil:
+	case string:
+		claims.Audience = []string{audience}
+	case []interface{}:
+		for _, value := range audience {
+			s, ok := value.(string)
+			if !ok {
+				return claims, fmt.Errorf("invalid aud claim")
+			}
+			claims.Audience = append(claims.Audience, s)
+		}
+	default:
+		return claims, fmt.Errorf("invalid aud claim")
+	}
+	return claims, err
+}
+
+func verifyHMAC(key interface{}, hash crypto.Hash, signed []byte, signature []byte) bool {
+	secret, ok := key.([]byte)
+	if !ok || len(secret) == 0 {
+		return false
+	}
+	mac := hmac.New(hash.New, secret)
+	mac.Write(signed)
+	return hmac.Equal(mac.Sum(nil), signature)
+}
+
+func verifyRSA(key interface{}, hash crypto.Hash, signed []byte, signature []byte) bool {
+	publicKey, ok := key.(*rsa.PublicKey)
+	return ok && rsa.VerifyPKCS1v15(publicKey, hash, digest(hash, signed), signature) == nil
+}
+
+func verifyRSAPSS(key interface{}, hash crypto.Hash, signed []byte, signature []byte) bool {
+	publicKey, ok := key.(*rsa.PublicKey)
+	options := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+	return ok && rsa.VerifyPSS(publicKey, hash, digest(hash, signed), signature, options) == nil
+}
+
+func verifyECDSA(curve elliptic.Curve) func(interface{}, crypto.Hash, []byte, []byte) bool {
+	return func(key interface{}, hash crypto.Hash, signed []byte, signature []byte) bool {
+		publicKey, ok := key.(*ecdsa.PublicKey)
+		size := (curve.Params().BitSize + 7) / 8
+		if !ok || publicKey.Curve != curve || len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(publicKey, digest(hash, signed), r, s)
+	}
+}
+
+func verifyEd25519(key interface{}, hash crypto.Hash, signed []byte, signature []byte) bool {
+	publicKey, ok := key.(ed25519.PublicKey)
+	return ok && len(publicKey) == ed25519.PublicKeySize && ed25519.Verify(publicKey, signed, signature)
+}
+
+func digest(hash crypto.Hash, data []byte) []byte {
+	h := hash.New()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+//JWTClaimsFromContext returns the claims of the token validated by JWTFilter
+func JWTClaimsFromContext(ctx context.Context) (JWTClaims, bool) {
+	claims, ok := ctx.Value(jwtClaimsKey).(JWTClaims)
+	return claims, ok
+}
+
+//JWTFilter permits requests with a valid JWT in the Authorization header ("Bearer <token>").
+//Requests without a valid token are answered with 401 Unauthorized and a Bearer challenge.
+//The validated claims are available to the following handlers with JWTClaimsFromContext:
+//  keys, err := middleware.NewJWKSet(middleware.JWKSFile("/etc/service/jwks.json"), time.Hour)
+//  requireToken := middleware.JWTFilter(middleware.JWTParams{
+//  	KeySet:    keys,
+//  	Issuers:   []string{"https://id.example.org"},
+//  	Audiences: []string{"orders-api"},
+//  	Leeway:    30 * time.Second,
+//  })
+//  handler := func(w http.ResponseWriter, r *http.Request) {
+//  	claims, _ := middleware.JWTClaimsFromContext(r.Context())
+//  	fmt.Fprintf(w, "Hi %s!", claims.Subject)
+//  }
+//It panics if one of the Algorithms is not supported or if there are no keys.
+func JWTFilter(params JWTParams) func(http.Handler) http.Handler {
+	if len(params.Keys) == 0 && params.KeySet == nil {
+		panic("Failed to create JWT filter: no keys")
+	}
+	algorithms := make(map[string]bool)
+	for name := range jwtAlgorithms {
+		algorithms[name] = len(params.Algorithms) == 0
+	}
+	for _, name := range params.Algorithms {
+		if _, ok := jwtAlgorithms[name]; !ok {
+			panic(fmt.Sprintf("Failed to create JWT filter: unsupported algorithm %s", name))
+		}
+		algorithms[name] = true
+	}
+	fn := func(next http.Handler) http.Handler {
+		return jwtFilter{next, params, algorithms, time.Now}
+	}
+	return fn
+}
@@ -0,0 +1,210 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testSigningKeys struct {
+	secret  []byte
+	rsa     *rsa.PrivateKey
+	ecdsa   *ecdsa.PrivateKey
+	ed25519 ed25519.PrivateKey
+}
+
+func newTestSigningKeys(t *testing.T) testSigningKeys {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testSigningKeys{[]byte("0123456789abcdef0123456789abcdef"), rsaKey, ecdsaKey, ed25519Key}
+}
+
+//sign creates a JWT with the given header and claims, signed with the key matching the algorithm
+func (keys testSigningKeys) sign(t *testing.T, header map[string]interface{}, claims map[string]interface{}) string {
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(header) + "." + encode(claims)
+	algorithm := header["alg"].(string)
+	var signature []byte
+	var err error
+	switch algorithm {
+	case "HS256", "HS512":
+		hash := jwtAlgorithms[algorithm].hash
+		mac := hmac.New(hash.New, keys.secret)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case "RS256":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, keys.rsa, crypto.SHA256, digest(crypto.SHA256, []byte(signed)))
+	case "PS256":
+		options := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+		signature, err = rsa.SignPSS(rand.Reader, keys.rsa, crypto.SHA256, digest(crypto.SHA256, []byte(signed)), options)
+	case "ES256":
+		r, s, signErr := ecdsa.Sign(rand.Reader, keys.ecdsa, digest(crypto.SHA256, []byte(signed)))
+		err = signErr
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	case "EdDSA":
+		signature = ed25519.Sign(keys.ed25519, []byte(signed))
+	case "none":
+	default:
+		t.Fatalf("unsupported algorithm %s", algorithm)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (keys testSigningKeys) public() []JWK {
+	return []JWK{
+		{Key: keys.secret},
+		{ID: "rsa", Key: &keys.rsa.PublicKey},
+		{ID: "ec", Key: &keys.ecdsa.PublicKey},
+		{ID: "ed", Algorithm: "EdDSA", Key: keys.ed25519.Public()},
+	}
+}
+
+func TestJWTFilter(t *testing.T) {
+	keys := newTestSigningKeys(t)
+	now := time.Now()
+	claims := func(modify func(map[string]interface{})) map[string]interface{} {
+		c := map[string]interface{}{"iss": "https://id.example.org", "sub": "alice", "aud": "orders", "exp": now.Add(time.Hour).Unix(), "iat": now.Unix()}
+		if modify != nil {
+			modify(c)
+		}
+		return c
+	}
+	header := func(algorithm string, id string) map[string]interface{} {
+		h := map[string]interface{}{"alg": algorithm, "typ": "JWT"}
+		if id != "" {
+			h["kid"] = id
+		}
+		return h
+	}
+	signed := strings.Split(keys.sign(t, header("HS256", ""), claims(nil)), ".")
+	forged := strings.Split(keys.sign(t, header("HS256", ""), claims(func(c map[string]interface{}) { c["sub"] = "admin" })), ".")
+	tampered := signed[0] + "." + forged[1] + "." + signed[2]
+	params := JWTParams{Keys: keys.public(), Issuers: []string{"https://id.example.org"}, Audiences: []string{"orders", "billing"}, Leeway: time.Minute}
+
+	tests := []struct {
+		name   string
+		params JWTParams
+		token  string
+		want   int
+	}{
+		{"HS256", params, keys.sign(t, header("HS256", ""), claims(nil)), 200},
+		{"HS512", params, keys.sign(t, header("HS512", ""), claims(nil)), 200},
+		{"RS256", params, keys.sign(t, header("RS256", "rsa"), claims(nil)), 200},
+		{"PS256", params, keys.sign(t, header("PS256", "rsa"), claims(nil)), 200},
+		{"ES256", params, keys.sign(t, header("ES256", "ec"), claims(nil)), 200},
+		{"EdDSA", params, keys.sign(t, header("EdDSA", "ed"), claims(nil)), 200},
+		{"RS256 without key id", params, keys.sign(t, header("RS256", ""), claims(nil)), 200},
+		{"wrong key id", params, keys.sign(t, header("RS256", "ec"), claims(nil)), 401},
+		{"algorithm none", params, keys.sign(t, header("none", ""), claims(nil)), 401},
+		{"algorithm not permitted", JWTParams{Keys: keys.public(), Algorithms: []string{"RS256"}}, keys.sign(t, header("HS256", ""), claims(nil)), 401},
+		{"HMAC with RSA key", JWTParams{Keys: keys.public()[1:2]}, keys.sign(t, header("HS256", "rsa"), claims(nil)), 401},
+		{"tampered claims", params, tampered, 401},
+		{"critical header", params, keys.sign(t, map[string]interface{}{"alg": "HS256", "crit": []string{"b64"}}, claims(nil)), 401},
+		{"expired", params, keys.sign(t, header("HS256", ""), claims(func(c map[string]interface{}) { c["exp"] = now.Add(-2 * time.Minute).Unix() })), 401},
+		{"expired within leeway", params, keys.sign(t, header("HS256", ""), claims(func(c map[string]interface{}) { c["exp"] = now.Add(-30 * time.Second).Unix() })), 200},
+		{"missing exp", params, keys.sign(t, header("HS256", ""), claims(func(c map[string]interface{}) { delete(c, "exp") })), 401},
+		{"invalid exp", params, keys.sign(t, header("HS256", ""), claims(func(c map[string]interface{}) { c["exp"] = "tomorrow" })), 401},
+		{"not yet valid", params, keys.sign(t, header("HS256", ""), claims(func(c map[string]interface{}) { c["nbf"] = now.Add(2 * time.Minute).Unix() })), 401},
+		{"not yet valid within leeway", params, keys.sign(t, header("HS256", ""), claims(func(c map[string]interface{}) { c["nbf"] = now.Add(30 * time.Second).Unix() })), 200},
+		{"issued in the future", params, keys.sign(t, header("HS256", ""), claims(func(c map[string]interface{}) { c["iat"] = now.Add(time.Hour).Unix() })), 401},
+		{"wrong issuer", params, keys.sign(t, header("HS256", ""), claims(func(c map[string]interface{}) { c["iss"] = "https://evil.example.org" })), 401},
+		{"audience list", params, keys.sign(t, header("HS256", ""), claims(func(c map[string]interface{}) { c["aud"] = []string{"other", "billing"} })), 200},
+		{"wrong audience", params, keys.sign(t, header("HS256", ""), claims(func(c map[string]interface{}) { c["aud"] = "other" })), 401},
+		{"malformed token", params, "not.a.token", 401},
+		{"missing token", params, "", 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var claims JWTClaims
+			handler := JWTFilter(tt.params)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				claims, _ = JWTClaimsFromContext(r.Context())
+			}))
+			request := httptest.NewRequest("GET", "/", nil)
+			if tt.token != "" {
+				request.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != tt.want {
+				t.Errorf("JWTFilter() status = %d, want %d", recorder.Code, tt.want)
+			}
+			wantChallenge := `Bearer error="invalid_token"`
+			if tt.token == "" {
+				wantChallenge = "Bearer"
+			}
+			if challenge := recorder.Header().Get("WWW-Authenticate"); tt.want == 401 && challenge != wantChallenge {
+				t.Errorf("JWTFilter() challenge = %s, want %s", challenge, wantChallenge)
+			}
+			if recorder.Code == 200 && (claims.Subject != "alice" || claims.Issuer != "https://id.example.org" || claims.ExpiresAt.IsZero()) {
+				t.Errorf("JWTClaimsFromContext() = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestJWTFilter_invalidParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		params JWTParams
+	}{
+		{"no keys", JWTParams{}},
+		{"unsupported algorithm", JWTParams{Keys: []JWK{{Key: []byte("secret")}}, Algorithms: []string{"none"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("JWTFilter() should panic")
+				}
+			}()
+			JWTFilter(tt.params)
+		})
+	}
+}
+
+func Test_newJWTClaims(t *testing.T) {
+	var raw map[string]interface{}
+	part := base64.RawURLEncoding.EncodeToString([]byte(`{"sub": "alice", "aud": ["a", "b"], "exp": 1600000000.5, "scope": "read write"}`))
+	if err := decodeJWTPart(part, &raw); err != nil {
+		t.Fatal(err)
+	}
+	claims, err := newJWTClaims(raw)
+	if err != nil {
+		t.Fatalf("newJWTClaims() error = %v", err)
+	}
+	if claims.Subject != "alice" || len(claims.Audience) != 2 || !claims.ExpiresAt.Equal(time.Unix(1600000000, 5e8)) || claims.Raw["scope"] != "read write" {
+		t.Errorf("newJWTClaims() = %+v", claims)
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"container/list"
+	"time"
+)
+
+//lruCache keeps at most maxEntries values in least recently used order. Values are also removed once the time
+//returned by expires has passed. It is not safe for concurrent use, the users hold their own lock.
+type lruCache struct {
+	maxEntries int
+	expires    func(value interface{}) time.Time
+	entries    map[interface{}]*list.Element
+	recent     *list.List
+}
+
+type lruEntry struct {
+	key   interface{}
+	value interface{}
+}
+
+func newLRUCache(maxEntries int, expires func(value interface{}) time.Time) *lruCache {
+	return &lruCache{
+		maxEntries: maxEntries,
+		expires:    expires,
+		entries:    make(map[interface{}]*list.Element),
+		recent:     list.New(),
+	}
+}
+
+//get returns the value of key unless it has expired and marks it as recently used
+func (c *lruCache) get(key interface{}, now time.Time) (interface{}, bool) {
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	value := element.Value.(*lruEntry).value
+	if !c.expires(value).After(now) {
+		c.recent.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.recent.MoveToFront(element)
+	return value, true
+}
+
+//add stores the value of key as the most recently used one and evicts the entries that exceed maxEntries
+func (c *lruCache) add(key interface{}, value interface{}, now time.Time) {
+	if element, ok := c.entries[key]; ok {
+		c.recent.Remove(element)
+	}
+	c.entries[key] = c.recent.PushFront(&lruEntry{key, value})
+	c.evict(now)
+}
+
+//evict removes expired entries from the end of the list and the least recently used ones beyond maxEntries
+func (c *lruCache) evict(now time.Time) {
+	for c.recent.Len() > 0 {
+		oldest := c.recent.Back()
+		entry := oldest.Value.(*lruEntry)
+		if c.recent.Len() <= c.maxEntries && c.expires(entry.value).After(now) {
+			return
+		}
+		c.recent.Remove(oldest)
+		delete(c.entries, entry.key)
+	}
+}
+
+func (c *lruCache) len() int {
+	return c.recent.Len()
+}
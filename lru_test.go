@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_lruCache(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	cache := newLRUCache(2, func(value interface{}) time.Time { return value.(time.Time) })
+
+	cache.add("a", now.Add(time.Minute), now)
+	cache.add("b", now.Add(time.Second), now)
+	cache.get("a", now)
+	cache.add("c", now.Add(time.Minute), now)
+	if _, ok := cache.get("b", now); ok {
+		t.Errorf("get() least recently used entry should have been evicted")
+	}
+	if _, ok := cache.get("a", now); !ok {
+		t.Errorf("get() recently used entry should be kept")
+	}
+	if _, ok := cache.get("c", now.Add(time.Minute)); ok {
+		t.Errorf("get() expired entry should not be returned")
+	}
+	if cache.len() != 1 {
+		t.Errorf("len() = %d, expired entry should be removed", cache.len())
+	}
+}
@@ -0,0 +1,249 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//MetricsParams configures NewMetrics. Namespace is the prefix of the metric names and defaults to "http".
+//Buckets are the upper bounds of the request duration histogram in seconds, they default to
+//0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5 and 10.
+type MetricsParams struct {
+	Namespace string
+	Buckets   []float64
+}
+
+//Metrics collects metrics of requests and filters and serves them in the Prometheus text exposition format:
+//  <namespace>_requests_in_flight                                gauge of the requests being handled
+//  <namespace>_request_duration_seconds{route, method, code}     histogram of the request durations
+//  <namespace>_filter_decisions_total{filter, decision, reason}  counter of allowed and denied requests
+//Instrument collects the request metrics and counts the denials of all filters that follow it,
+//with the Code of the DeniedError as reason. Filter additionally counts the requests a filter allows:
+//  metrics := middleware.NewMetrics(middleware.MetricsParams{})
+//  hooks := middleware.Assemble(metrics.Instrument, metrics.Filter("hmac", middleware.HmacFilter(params)))
+//  mux.Handle("POST /hooks/github", hooks.ApplyToFunc(handler))
+//  mux.Handle("GET /metrics", metrics)
+type Metrics struct {
+	namespace string
+	buckets   []float64
+	inFlight  int64
+	mu        sync.Mutex
+	durations map[string]*histogram
+	decisions map[string]uint64
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+//metricsScope collects the outcome of a filter for the innermost Instrument or Filter of the request,
+//and the route of the request for all enclosing Instruments
+type metricsScope struct {
+	parent *metricsScope
+	passed bool
+	denial *DeniedError
+	route  string
+}
+
+//recordRoute notes the pattern of the http.ServeMux route that handles the request for the enclosing Instruments,
+//which do not see the pattern if a middleware between them and the mux passes a copy of the request
+func recordRoute(r *http.Request) {
+	scope, _ := r.Context().Value(metricsScopeKey).(*metricsScope)
+	for ; scope != nil && r.Pattern != ""; scope = scope.parent {
+		scope.route = r.Pattern
+	}
+}
+
+//recordDenial notes the error for the metrics of the request, if it is a denial
+func recordDenial(ctx context.Context, err error) {
+	var denied *DeniedError
+	if scope, ok := ctx.Value(metricsScopeKey).(*metricsScope); ok && scope != nil && errors.As(err, &denied) {
+		scope.denial = denied
+	}
+}
+
+//NewMetrics creates an empty collection of metrics
+func NewMetrics(params MetricsParams) *Metrics {
+	if params.Namespace == "" {
+		params.Namespace = "http"
+	}
+	if len(params.Buckets) == 0 {
+		params.Buckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	}
+	buckets := append([]float64(nil), params.Buckets...)
+	sort.Float64s(buckets)
+	return &Metrics{namespace: params.Namespace, buckets: buckets, durations: make(map[string]*histogram), decisions: make(map[string]uint64)}
+}
+
+//Instrument is a middleware that measures the duration of the requests and counts the denials of the following filters.
+//Requests are labeled with the pattern of the http.ServeMux route that handled them, so Instrument may be used
+//both in the chains of single routes and in front of a mux. In front of a plain http.ServeMux, Instrument must
+//wrap the mux directly, since the mux sets the pattern only in the request it receives. Routes registered
+//through a Group report their pattern to Instrument, so other middlewares may be placed between them:
+//  root := middleware.NewGroup(nil)
+//  root.Get("/users/{id}", getUser)
+//  server := metrics.Instrument(middleware.RequestID(middleware.RequestIDParams{})(root))
+func (m *Metrics) Instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		m.inFlight++
+		m.mu.Unlock()
+		start := time.Now()
+		parent, _ := r.Context().Value(metricsScopeKey).(*metricsScope)
+		scope := &metricsScope{parent: parent}
+		recorder := WrapResponseWriter(w)
+		r = r.WithContext(context.WithValue(r.Context(), metricsScopeKey, scope))
+		defer func() {
+			duration := time.Since(start).Seconds()
+			status := recorder.Status()
+			if status == 0 {
+				status = 200
+			}
+			// a following http.ServeMux sets the pattern of the route in the request it receives,
+			// a Group reports it even if the mux received a copy of the request
+			route := r.Pattern
+			if route == "" {
+				route = scope.route
+			}
+			if route == "" {
+				route = "unmatched"
+			}
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			m.inFlight--
+			m.observe(labels("route", route, "method", metricsMethod(r.Method), "code", strconv.Itoa(status)), duration)
+			if scope.denial != nil {
+				m.decisions[labels("filter", scope.denial.Filter, "decision", "denied", "reason", denialCode(scope.denial))]++
+			}
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+//Filter wraps a filter to count the requests it allows and denies under the given name.
+//The denials are counted with the Code of the DeniedError written by the filter as reason, or "unknown".
+func (m *Metrics) Filter(name string, filter Middleware) Middleware {
+	return func(next http.Handler) http.Handler {
+		filtered := filter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scope := r.Context().Value(metricsScopeKey).(*metricsScope)
+			scope.passed = true
+			// denials of the following filters are counted by the enclosing scope
+			ctx := context.WithValue(r.Context(), metricsScopeKey, scope.parent)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			parent, _ := r.Context().Value(metricsScopeKey).(*metricsScope)
+			scope := &metricsScope{parent: parent}
+			filtered.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), metricsScopeKey, scope)))
+			key := labels("filter", name, "decision", "allowed", "reason", "")
+			if !scope.passed {
+				key = labels("filter", name, "decision", "denied", "reason", denialCode(scope.denial))
+			}
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			m.decisions[key]++
+		})
+	}
+}
+
+func denialCode(denied *DeniedError) string {
+	if denied == nil || denied.Code == "" {
+		return "unknown"
+	}
+	return denied.Code
+}
+
+//metricsMethod limits the method label to the standard methods
+func metricsMethod(method string) string {
+	switch method {
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "CONNECT", "OPTIONS", "TRACE":
+		return method
+	}
+	return "OTHER"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+//labels formats label names and values as in the exposition format, e.g. {filter="hmac"}
+func labels(namesAndValues ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(namesAndValues); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		value := labelEscaper.Replace(namesAndValues[i+1])
+		fmt.Fprintf(&b, "%s=\"%s\"", namesAndValues[i], value)
+	}
+	return b.String()
+}
+
+func (m *Metrics) observe(key string, value float64) {
+	h, ok := m.durations[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.durations[key] = h
+	}
+	for i, bound := range m.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+//ServeHTTP writes the metrics in the Prometheus text exposition format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	m.mu.Lock()
+	name := m.namespace + "_requests_in_flight"
+	fmt.Fprintf(&b, "# HELP %s Number of requests being handled.\n# TYPE %s gauge\n%s %d\n", name, name, name, m.inFlight)
+
+	name = m.namespace + "_request_duration_seconds"
+	fmt.Fprintf(&b, "# HELP %s Duration of requests by route, method and status code.\n# TYPE %s histogram\n", name, name)
+	for _, key := range sortedKeys(m.durations) {
+		h := m.durations[key]
+		for i, bound := range m.buckets {
+			fmt.Fprintf(&b, "%s_bucket{%s,le=\"%s\"} %d\n", name, key, formatFloat(bound), h.counts[i])
+		}
+		fmt.Fprintf(&b, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, key, h.count)
+		fmt.Fprintf(&b, "%s_sum{%s} %s\n", name, key, formatFloat(h.sum))
+		fmt.Fprintf(&b, "%s_count{%s} %d\n", name, key, h.count)
+	}
+
+	name = m.namespace + "_filter_decisions_total"
+	fmt.Fprintf(&b, "# HELP %s Requests allowed and denied by filters.\n# TYPE %s counter\n", name, name)
+	for _, key := range sortedKeys(m.decisions) {
+		fmt.Fprintf(&b, "%s{%s} %d\n", name, key, m.decisions[key])
+	}
+	m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	metrics := NewMetrics(MetricsParams{Namespace: "test", Buckets: []float64{10, 0.5}})
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	hmac := metrics.Filter("github", HmacFilter(HmacParams{Provider: "github", Secret: "secret"}))
+	internal := IPFilter([]string{"10.0.0.0/8"}, "")
+	mux := http.NewServeMux()
+	mux.Handle("POST /hooks/{provider}", Assemble(hmac, internal).ApplyToFunc(handler))
+	mux.Handle("GET /users/{id}", ErrorHandler(func(w http.ResponseWriter, r *http.Request) error {
+		return &DeniedError{Status: 403, Filter: "custom", Reason: "no code"}
+	}))
+	mux.Handle("GET /metrics", metrics)
+	server := metrics.Instrument(mux)
+
+	requests := []struct {
+		method string
+		target string
+		header http.Header
+		remote string
+	}{
+		{"POST", "/hooks/github", http.Header{"X-Hub-Signature": {"sha1=5d61605c3feea9799210ddcb71307d4ba264225f"}}, "10.0.0.1:1234"},
+		{"POST", "/hooks/github", nil, "10.0.0.1:1234"},
+		{"POST", "/hooks/github", nil, "10.0.0.1:1234"},
+		{"DELETE", "/hooks/github", nil, "10.0.0.1:1234"},
+		{"GET", "/users/1", nil, "10.0.0.1:1234"},
+		{"BREW", "/pot", nil, "10.0.0.1:1234"},
+	}
+	for _, request := range requests {
+		r := httptest.NewRequest(request.method, request.target, strings.NewReader("{}"))
+		if request.header != nil {
+			r.Header = request.header
+		}
+		r.RemoteAddr = request.remote
+		server.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	// an allowed request that is denied by the following IPFilter
+	r := httptest.NewRequest("POST", "/hooks/github", strings.NewReader("{}"))
+	r.Header.Set("X-Hub-Signature", "sha1=5d61605c3feea9799210ddcb71307d4ba264225f")
+	server.ServeHTTP(httptest.NewRecorder(), r)
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if got := recorder.Header().Get("Content-Type"); got != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content-Type = %s", got)
+	}
+	output := recorder.Body.String()
+	for _, want := range []string{
+		"# TYPE test_requests_in_flight gauge\ntest_requests_in_flight 1\n",
+		"# TYPE test_request_duration_seconds histogram\n",
+		`test_request_duration_seconds_bucket{route="POST /hooks/{provider}",method="POST",code="403",le="0.5"} 3` + "\n",
+		`test_request_duration_seconds_bucket{route="POST /hooks/{provider}",method="POST",code="403",le="10"} 3` + "\n",
+		`test_request_duration_seconds_bucket{route="POST /hooks/{provider}",method="POST",code="403",le="+Inf"} 3` + "\n",
+		`test_request_duration_seconds_count{route="POST /hooks/{provider}",method="POST",code="200"} 1` + "\n",
+		`test_request_duration_seconds_count{route="unmatched",method="DELETE",code="405"} 1` + "\n",
+		`test_request_duration_seconds_count{route="unmatched",method="OTHER",code="404"} 1` + "\n",
+		"# TYPE test_filter_decisions_total counter\n",
+		`test_filter_decisions_total{filter="github",decision="allowed",reason=""} 2` + "\n",
+		`test_filter_decisions_total{filter="github",decision="denied",reason="invalid_signature"} 2` + "\n",
+		`test_filter_decisions_total{filter="ip",decision="denied",reason="ip_not_permitted"} 1` + "\n",
+		`test_filter_decisions_total{filter="custom",decision="denied",reason="unknown"} 1` + "\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("metrics do not contain %q:\n%s", want, output)
+		}
+	}
+	if strings.Count(output, "test_filter_decisions_total{") != 4 {
+		t.Errorf("denials are counted more than once:\n%s", output)
+	}
+}
+
+func TestMetrics_labels(t *testing.T) {
+	if got := labels("route", `GET /a"b\c`+"\n", "code", "200"); got != `route="GET /a\"b\\c\n",code="200"` {
+		t.Errorf("labels() = %s", got)
+	}
+}
+
+func TestMetrics_groupRoute(t *testing.T) {
+	metrics := NewMetrics(MetricsParams{Namespace: "test"})
+	root := NewGroup(nil)
+	root.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	// RequestID passes a copy of the request to the mux, which sets the pattern only in the copy
+	server := metrics.Instrument(RequestID(RequestIDParams{})(root))
+	server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/1", nil))
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	want := `test_request_duration_seconds_count{route="GET /users/{id}",method="GET",code="200"} 1`
+	if !strings.Contains(recorder.Body.String(), want) {
+		t.Errorf("metrics do not contain %q:\n%s", want, recorder.Body.String())
+	}
+}
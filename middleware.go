@@ -7,6 +7,24 @@ import (
 	"net/http"
 )
 
+//contextKey is the type of the keys under which the middlewares store values in the request context
+type contextKey int
+
+const (
+	clientCertKey contextKey = iota
+	apiKeyKey
+	jwtClaimsKey
+	introspectionKey
+	basicAuthUserKey
+	principalKey
+	cspNonceKey
+	errorHandlerKey
+	accessLogKey
+	requestIDKey
+	metricsScopeKey
+	banScopeKey
+)
+
 //Middleware is a type alias for the typical signature of a Go net/http middleware
 type Middleware func(http.Handler) http.Handler
 
@@ -55,6 +73,30 @@ func (m Middleware) Prepend(other Middleware) Middleware {
 	return other.Append(m)
 }
 
+//When returns a middleware that only applies m to requests that satisfy the predicate.
+//All other requests are passed directly to the next handler:
+//  verifyHook := middleware.Middleware(middleware.HmacFilter(params))
+//  hooks := verifyHook.When(middleware.Method("POST").And(middleware.PathGlob("/hooks/*")))
+//  mux.Handle("/", hooks(handler))
+func (m Middleware) When(predicate Predicate) Middleware {
+	return func(next http.Handler) http.Handler {
+		applied := m(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if predicate(r) {
+				applied.ServeHTTP(w, r)
+			} else {
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+//Unless returns a middleware that only applies m to requests that do not satisfy the predicate:
+//  requireLogin.Unless(middleware.PathPrefix("/health", "/metrics"))
+func (m Middleware) Unless(predicate Predicate) Middleware {
+	return m.When(predicate.Not())
+}
+
 //Assemble can be used to chain an arbitrary number of middlewares
 //  middlewares := middleware.Assemble(middlewareA, middlewareB, middlewareC)
 func Assemble(middlewares ...Middleware) Middleware {
@@ -65,6 +107,21 @@ func Assemble(middlewares ...Middleware) Middleware {
 	return assembly
 }
 
+//AssembleEntries chains named middlewares like Assemble, but first orders them according to their constraints
+//(see Entry). It returns an error if the constraints contradict each other or an entry that may be used only once
+//appears more than once:
+//  middlewares, err := middleware.AssembleEntries(
+//  	middleware.Entry{Name: "ratelimit", Middleware: rateLimit, After: []string{"auth"}},
+//  	middleware.Entry{Name: "auth", Middleware: requireToken, Once: true},
+//  )
+func AssembleEntries(entries ...Entry) (Middleware, error) {
+	chain, err := NewChain(entries...).Sort()
+	if err != nil {
+		return nil, err
+	}
+	return chain.Middleware(), nil
+}
+
 //ApplyToFunc is a convenience function to apply middleware to a HandlerFunc:
 //  mux := http.NewServeMux()
 //  handler := func(w http.ResponseWriter, r *http.Request) {
@@ -2,6 +2,7 @@ package middleware_test
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/seb-ehm/middleware"
@@ -77,3 +78,30 @@ func Test_MiddlewareAppend(t *testing.T) {
 	})
 
 }
+
+func Test_MiddlewareWhen(t *testing.T) {
+	hello := middleware.Middleware(GetGreeting("Hello!"))
+	namaste := GetGreeting("Namaste!")
+	isPost := middleware.Method("POST")
+
+	tests := []struct {
+		name        string
+		middlewares middleware.Middleware
+		method      string
+		want        string
+	}{
+		{"When satisfied", middleware.Assemble(hello.When(isPost), namaste), "POST", "Hello!\nNamaste!\n"},
+		{"When not satisfied", middleware.Assemble(hello.When(isPost), namaste), "GET", "Namaste!\n"},
+		{"Unless satisfied", middleware.Assemble(hello.Unless(isPost), namaste), "POST", "Namaste!\n"},
+		{"Unless not satisfied", middleware.Assemble(hello.Unless(isPost), namaste), "GET", "Hello!\nNamaste!\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := new(MockResponseWriter)
+			tt.middlewares.ServeHTTP(mock, httptest.NewRequest(tt.method, "/", nil))
+			if mock.output != tt.want {
+				t.Errorf("When(): got %v, want %v", mock.output, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,388 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"net"
+)
+
+//mmdbMetadataMarker precedes the metadata section at the end of a MaxMind DB file
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+//Data types of the MaxMind DB data section, see https://maxmind.github.io/MaxMind-DB/
+const (
+	mmdbExtended = iota
+	mmdbPointer
+	mmdbString
+	mmdbDouble
+	mmdbBytes
+	mmdbUint16
+	mmdbUint32
+	mmdbMap
+	mmdbInt32
+	mmdbUint64
+	mmdbUint128
+	mmdbArray
+	mmdbContainer
+	mmdbEndMarker
+	mmdbBool
+	mmdbFloat
+)
+
+//mmdbMaxDepth limits the nesting of maps, arrays and pointers to protect against corrupt databases
+const mmdbMaxDepth = 32
+
+//GeoDB is a MaxMind DB file (e.g. GeoLite2-Country or GeoLite2-ASN) that is read into memory
+//to look up the location or network of client ip addresses without calling external services.
+type GeoDB struct {
+	tree         []byte
+	data         mmdbDecoder
+	nodeCount    uint
+	recordSize   uint
+	ipVersion    uint
+	ipv4Start    uint
+	databaseType string
+}
+
+//GeoRecord contains the fields of a MaxMind DB entry that can be used to filter requests.
+//Fields that are not part of the database type are left empty.
+type GeoRecord struct {
+	Country        string //ISO 3166-1 country code, e.g. "DE"
+	Continent      string //continent code, e.g. "EU"
+	ASN            uint32 //autonomous system number, e.g. 3320
+	ASOrganization string
+}
+
+//OpenGeoDB reads a MaxMind DB file:
+//  countries, err := middleware.OpenGeoDB("GeoLite2-Country.mmdb")
+func OpenGeoDB(path string) (*GeoDB, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := newGeoDB(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MaxMind DB %s: %w", path, err)
+	}
+	return db, nil
+}
+
+func newGeoDB(content []byte) (*GeoDB, error) {
+	markerIndex := bytes.LastIndex(content, mmdbMetadataMarker)
+	if markerIndex == -1 {
+		return nil, fmt.Errorf("metadata not found")
+	}
+	metadataDecoder := mmdbDecoder{content[markerIndex+len(mmdbMetadataMarker):]}
+	value, _, err := metadataDecoder.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %w", err)
+	}
+	metadata, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid metadata: expected map")
+	}
+
+	db := &GeoDB{}
+	db.nodeCount, _ = metadataUint(metadata, "node_count")
+	db.recordSize, _ = metadataUint(metadata, "record_size")
+	db.ipVersion, _ = metadataUint(metadata, "ip_version")
+	db.databaseType, _ = metadata["database_type"].(string)
+	if db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported record size %d", db.recordSize)
+	}
+	if db.ipVersion != 4 && db.ipVersion != 6 {
+		return nil, fmt.Errorf("unsupported ip version %d", db.ipVersion)
+	}
+
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+16 > uint(markerIndex) {
+		return nil, fmt.Errorf("search tree exceeds file size")
+	}
+	db.tree = content[:treeSize]
+	db.data = mmdbDecoder{content[treeSize+16 : markerIndex]}
+
+	// IPv4 addresses are stored in the IPv6 tree as ::a.b.c.d
+	if db.ipVersion == 6 {
+		for i := 0; i < 96 && db.ipv4Start < db.nodeCount; i++ {
+			db.ipv4Start = db.readRecord(db.ipv4Start, 0)
+		}
+	}
+	return db, nil
+}
+
+//DatabaseType returns the type of the database as stated in its metadata, e.g. "GeoLite2-Country"
+func (db *GeoDB) DatabaseType() string {
+	return db.databaseType
+}
+
+//Lookup returns the entry for an ip address. found is false if the database has no entry for the address.
+func (db *GeoDB) Lookup(ip net.IP) (record GeoRecord, found bool, err error) {
+	value, found, err := db.lookupValue(ip)
+	if err != nil || !found {
+		return record, found, err
+	}
+	entry, ok := value.(map[string]interface{})
+	if !ok {
+		return record, false, fmt.Errorf("invalid entry for %s: expected map", ip)
+	}
+	record.Country = nestedString(entry, "country", "iso_code")
+	if record.Country == "" {
+		record.Country = nestedString(entry, "registered_country", "iso_code")
+	}
+	record.Continent = nestedString(entry, "continent", "code")
+	if asn, ok := metadataUint(entry, "autonomous_system_number"); ok {
+		record.ASN = uint32(asn)
+	}
+	record.ASOrganization, _ = entry["autonomous_system_organization"].(string)
+	return record, true, nil
+}
+
+func (db *GeoDB) lookupValue(ip net.IP) (interface{}, bool, error) {
+	address := ip.To4()
+	node := uint(0)
+	if address != nil {
+		node = db.ipv4Start
+	} else {
+		if db.ipVersion == 4 {
+			return nil, false, nil
+		}
+		address = ip.To16()
+		if address == nil {
+			return nil, false, fmt.Errorf("invalid IP: %s", ip)
+		}
+	}
+
+	for i := 0; i < len(address)*8 && node < db.nodeCount; i++ {
+		bit := (address[i/8] >> (7 - uint(i)%8)) & 1
+		node = db.readRecord(node, bit)
+	}
+	if node == db.nodeCount {
+		return nil, false, nil
+	}
+	if node < db.nodeCount {
+		return nil, false, fmt.Errorf("invalid search tree: no entry after last bit of %s", ip)
+	}
+	value, _, err := db.data.decode(node-db.nodeCount-16, 0)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (db *GeoDB) readRecord(node uint, bit byte) uint {
+	switch db.recordSize {
+	case 24:
+		offset := node*6 + uint(bit)*3
+		b := db.tree[offset : offset+3]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		offset := node * 7
+		b := db.tree[offset : offset+7]
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		offset := node*8 + uint(bit)*4
+		return uint(binary.BigEndian.Uint32(db.tree[offset : offset+4]))
+	}
+}
+
+//mmdbDecoder decodes values of the data section of a MaxMind DB
+type mmdbDecoder struct {
+	data []byte
+}
+
+//decode decodes the value at offset and returns it together with the offset of the following value
+func (d mmdbDecoder) decode(offset uint, depth int) (interface{}, uint, error) {
+	if depth > mmdbMaxDepth {
+		return nil, 0, fmt.Errorf("data nested too deeply")
+	}
+	if offset >= uint(len(d.data)) {
+		return nil, 0, fmt.Errorf("offset %d out of range", offset)
+	}
+	control := d.data[offset]
+	offset++
+	dataType := int(control >> 5)
+
+	if dataType == mmdbPointer {
+		pointer, next, err := d.decodePointer(control, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer, depth+1)
+		return value, next, err
+	}
+
+	if dataType == mmdbExtended {
+		if offset >= uint(len(d.data)) {
+			return nil, 0, fmt.Errorf("offset %d out of range", offset)
+		}
+		dataType = 7 + int(d.data[offset])
+		offset++
+	}
+	size, offset, err := d.decodeSize(control, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch dataType {
+	case mmdbMap:
+		return d.decodeMap(size, offset, depth)
+	case mmdbArray:
+		return d.decodeArray(size, offset, depth)
+	case mmdbBool:
+		if size > 1 {
+			return nil, 0, fmt.Errorf("invalid boolean size %d", size)
+		}
+		return size == 1, offset, nil
+	}
+
+	if offset+size > uint(len(d.data)) {
+		return nil, 0, fmt.Errorf("value of size %d at offset %d out of range", size, offset)
+	}
+	payload := d.data[offset : offset+size]
+	next := offset + size
+	switch dataType {
+	case mmdbString:
+		return string(payload), next, nil
+	case mmdbBytes:
+		return append([]byte(nil), payload...), next, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(payload)), next, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d", size)
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(payload)), next, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64:
+		maxSize := map[int]uint{mmdbUint16: 2, mmdbUint32: 4, mmdbUint64: 8}[dataType]
+		if size > maxSize {
+			return nil, 0, fmt.Errorf("invalid unsigned integer size %d", size)
+		}
+		var value uint64
+		for _, b := range payload {
+			value = value<<8 | uint64(b)
+		}
+		return value, next, nil
+	case mmdbInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("invalid int32 size %d", size)
+		}
+		var value uint32
+		for _, b := range payload {
+			value = value<<8 | uint32(b)
+		}
+		return int32(value), next, nil
+	case mmdbUint128:
+		if size > 16 {
+			return nil, 0, fmt.Errorf("invalid uint128 size %d", size)
+		}
+		return new(big.Int).SetBytes(payload), next, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported data type %d at offset %d", dataType, offset)
+	}
+}
+
+func (d mmdbDecoder) decodePointer(control byte, offset uint) (pointer uint, next uint, err error) {
+	pointerSize := uint((control>>3)&0x3) + 1
+	if offset+pointerSize > uint(len(d.data)) {
+		return 0, 0, fmt.Errorf("pointer at offset %d out of range", offset)
+	}
+	b := d.data[offset : offset+pointerSize]
+	value := uint(control & 0x7)
+	switch pointerSize {
+	case 1:
+		pointer = value<<8 | uint(b[0])
+	case 2:
+		pointer = (value<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+	case 3:
+		pointer = (value<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+	default:
+		pointer = uint(binary.BigEndian.Uint32(b))
+	}
+	return pointer, offset + pointerSize, nil
+}
+
+func (d mmdbDecoder) decodeSize(control byte, offset uint) (uint, uint, error) {
+	size := uint(control & 0x1f)
+	if size < 29 {
+		return size, offset, nil
+	}
+	bytesToRead := size - 28
+	if offset+bytesToRead > uint(len(d.data)) {
+		return 0, 0, fmt.Errorf("size at offset %d out of range", offset)
+	}
+	var extra uint
+	for _, b := range d.data[offset : offset+bytesToRead] {
+		extra = extra<<8 | uint(b)
+	}
+	switch size {
+	case 29:
+		size = 29 + extra
+	case 30:
+		size = 285 + extra
+	default:
+		size = 65821 + extra
+	}
+	return size, offset + bytesToRead, nil
+}
+
+func (d mmdbDecoder) decodeMap(size uint, offset uint, depth int) (interface{}, uint, error) {
+	entries := make(map[string]interface{})
+	for i := uint(0); i < size; i++ {
+		key, next, err := d.decode(offset, depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		keyString, ok := key.(string)
+		if !ok {
+			return nil, 0, fmt.Errorf("invalid map key at offset %d", offset)
+		}
+		value, next, err := d.decode(next, depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries[keyString] = value
+		offset = next
+	}
+	return entries, offset, nil
+}
+
+func (d mmdbDecoder) decodeArray(size uint, offset uint, depth int) (interface{}, uint, error) {
+	var values []interface{}
+	for i := uint(0); i < size; i++ {
+		value, next, err := d.decode(offset, depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		values = append(values, value)
+		offset = next
+	}
+	return values, offset, nil
+}
+
+func metadataUint(entries map[string]interface{}, key string) (uint, bool) {
+	value, ok := entries[key].(uint64)
+	return uint(value), ok
+}
+
+func nestedString(entries map[string]interface{}, keys ...string) string {
+	var value interface{} = entries
+	for _, key := range keys {
+		nested, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		value = nested[key]
+	}
+	s, _ := value.(string)
+	return s
+}
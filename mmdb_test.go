@@ -0,0 +1,348 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/big"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+//mmdbTestPointer is encoded as a pointer into the data section by mmdbTestWriter
+type mmdbTestPointer uint
+
+//mmdbTestWriter encodes values in the MaxMind DB data section format
+type mmdbTestWriter struct {
+	bytes.Buffer
+}
+
+func (w *mmdbTestWriter) control(dataType int, size int) {
+	var sizeBytes []byte
+	switch {
+	case size < 29:
+	case size < 285:
+		sizeBytes = []byte{byte(size - 29)}
+		size = 29
+	case size < 65821:
+		size -= 285
+		sizeBytes = []byte{byte(size >> 8), byte(size)}
+		size = 30
+	default:
+		size -= 65821
+		sizeBytes = []byte{byte(size >> 16), byte(size >> 8), byte(size)}
+		size = 31
+	}
+	if dataType <= 7 {
+		w.WriteByte(byte(dataType<<5 | size))
+	} else {
+		w.WriteByte(byte(size))
+		w.WriteByte(byte(dataType - 7))
+	}
+	w.Write(sizeBytes)
+}
+
+func (w *mmdbTestWriter) unsigned(dataType int, value uint64) {
+	var b []byte
+	for ; value > 0; value >>= 8 {
+		b = append([]byte{byte(value)}, b...)
+	}
+	w.control(dataType, len(b))
+	w.Write(b)
+}
+
+func (w *mmdbTestWriter) encode(value interface{}) {
+	switch v := value.(type) {
+	case string:
+		w.control(mmdbString, len(v))
+		w.WriteString(v)
+	case []byte:
+		w.control(mmdbBytes, len(v))
+		w.Write(v)
+	case float64:
+		w.control(mmdbDouble, 8)
+		binary.Write(w, binary.BigEndian, math.Float64bits(v))
+	case float32:
+		w.control(mmdbFloat, 4)
+		binary.Write(w, binary.BigEndian, math.Float32bits(v))
+	case uint16:
+		w.unsigned(mmdbUint16, uint64(v))
+	case uint32:
+		w.unsigned(mmdbUint32, uint64(v))
+	case uint64:
+		w.unsigned(mmdbUint64, v)
+	case *big.Int:
+		w.control(mmdbUint128, len(v.Bytes()))
+		w.Write(v.Bytes())
+	case int32:
+		w.control(mmdbInt32, 4)
+		binary.Write(w, binary.BigEndian, v)
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		w.control(mmdbBool, size)
+	case []interface{}:
+		w.control(mmdbArray, len(v))
+		for _, element := range v {
+			w.encode(element)
+		}
+	case map[string]interface{}:
+		w.control(mmdbMap, len(v))
+		var keys []string
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			w.encode(key)
+			w.encode(v[key])
+		}
+	case mmdbTestPointer:
+		p := uint(v)
+		switch {
+		case p < 2048:
+			w.Write([]byte{byte(mmdbPointer<<5 | (p>>8)&0x7), byte(p)})
+		case p < 526336:
+			p -= 2048
+			w.Write([]byte{byte(mmdbPointer<<5 | 1<<3 | (p>>16)&0x7), byte(p >> 8), byte(p)})
+		case p < 134744064:
+			p -= 526336
+			w.Write([]byte{byte(mmdbPointer<<5 | 2<<3 | (p>>24)&0x7), byte(p >> 16), byte(p >> 8), byte(p)})
+		default:
+			w.Write([]byte{byte(mmdbPointer<<5 | 3<<3), byte(p >> 24), byte(p >> 16), byte(p >> 8), byte(p)})
+		}
+	default:
+		panic("unsupported type")
+	}
+}
+
+//mmdbTestNetwork assigns the value at offset in the data section to a network
+type mmdbTestNetwork struct {
+	network string
+	offset  uint
+}
+
+//buildTestMMDB creates an IPv6 MaxMind DB with IPv4 networks below ::/96. The networks must not overlap.
+func buildTestMMDB(recordSize uint, data []byte, networks []mmdbTestNetwork) []byte {
+	const empty = -1
+	type record struct {
+		node int
+		data int
+	}
+	nodes := [][2]record{{{empty, empty}, {empty, empty}}}
+	for _, n := range networks {
+		ip, ipNet, err := net.ParseCIDR(n.network)
+		if err != nil {
+			panic(err)
+		}
+		ones, _ := ipNet.Mask.Size()
+		address := ip.To16()
+		if ip.To4() != nil {
+			address = append(make([]byte, 12), ip.To4()...)
+			ones += 96
+		}
+		node := 0
+		for i := 0; i < ones; i++ {
+			bit := (address[i/8] >> (7 - uint(i)%8)) & 1
+			if i == ones-1 {
+				nodes[node][bit] = record{empty, int(n.offset)}
+				break
+			}
+			if nodes[node][bit].node == empty {
+				nodes = append(nodes, [2]record{{empty, empty}, {empty, empty}})
+				nodes[node][bit] = record{len(nodes) - 1, empty}
+			}
+			node = nodes[node][bit].node
+		}
+	}
+
+	nodeCount := uint(len(nodes))
+	value := func(r record) uint {
+		switch {
+		case r.node != empty:
+			return uint(r.node)
+		case r.data != empty:
+			return nodeCount + 16 + uint(r.data)
+		default:
+			return nodeCount
+		}
+	}
+	var db bytes.Buffer
+	for _, node := range nodes {
+		left, right := value(node[0]), value(node[1])
+		switch recordSize {
+		case 24:
+			db.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), byte(right >> 16), byte(right >> 8), byte(right)})
+		case 28:
+			db.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), byte((left>>24)<<4 | (right >> 24)), byte(right >> 16), byte(right >> 8), byte(right)})
+		case 32:
+			binary.Write(&db, binary.BigEndian, uint32(left))
+			binary.Write(&db, binary.BigEndian, uint32(right))
+		}
+	}
+	db.Write(make([]byte, 16))
+	db.Write(data)
+	db.Write(mmdbMetadataMarker)
+	metadata := mmdbTestWriter{}
+	metadata.encode(map[string]interface{}{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1600000000),
+		"database_type":               "Test-Country-ASN",
+		"description":                 map[string]interface{}{"en": "Test database"},
+		"ip_version":                  uint16(6),
+		"languages":                   []interface{}{"en"},
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(recordSize),
+	})
+	db.Write(metadata.Bytes())
+	return db.Bytes()
+}
+
+//testGeoData returns a data section with entries for Germany (using a pointer to a shared continent),
+//France, and a network with an ASN, together with their networks
+func testGeoData() ([]byte, []mmdbTestNetwork) {
+	w := mmdbTestWriter{}
+	europe := uint(w.Len())
+	w.encode(map[string]interface{}{"code": "EU", "geoname_id": uint32(6255148), "names": map[string]interface{}{"en": "Europe"}})
+	germany := uint(w.Len())
+	w.encode(map[string]interface{}{
+		"continent": mmdbTestPointer(europe),
+		"country":   map[string]interface{}{"iso_code": "DE", "geoname_id": uint32(2921044)},
+	})
+	france := uint(w.Len())
+	w.encode(map[string]interface{}{
+		"continent":          mmdbTestPointer(europe),
+		"registered_country": map[string]interface{}{"iso_code": "FR"},
+	})
+	telekom := uint(w.Len())
+	w.encode(map[string]interface{}{"autonomous_system_number": uint32(3320), "autonomous_system_organization": "Deutsche Telekom AG"})
+	return w.Bytes(), []mmdbTestNetwork{
+		{"81.2.69.0/24", germany},
+		{"2001:db8::/32", france},
+		{"80.128.0.0/11", telekom},
+	}
+}
+
+func TestGeoDB_Lookup(t *testing.T) {
+	data, networks := testGeoData()
+	tests := []struct {
+		name      string
+		ip        string
+		want      GeoRecord
+		wantFound bool
+	}{
+		{"IPv4 country with pointer to continent", "81.2.69.142", GeoRecord{Country: "DE", Continent: "EU"}, true},
+		{"IPv6 registered country", "2001:db8::1", GeoRecord{Country: "FR", Continent: "EU"}, true},
+		{"ASN", "80.130.1.1", GeoRecord{ASN: 3320, ASOrganization: "Deutsche Telekom AG"}, true},
+		{"IPv4 not found", "8.8.8.8", GeoRecord{}, false},
+		{"IPv6 not found", "2001:db9::1", GeoRecord{}, false},
+	}
+	for _, recordSize := range []uint{24, 28, 32} {
+		db, err := newGeoDB(buildTestMMDB(recordSize, data, networks))
+		if err != nil {
+			t.Fatalf("newGeoDB() record size %d: %v", recordSize, err)
+		}
+		if db.DatabaseType() != "Test-Country-ASN" {
+			t.Errorf("DatabaseType() = %s", db.DatabaseType())
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				got, found, err := db.Lookup(net.ParseIP(tt.ip))
+				if err != nil {
+					t.Fatalf("Lookup() record size %d error = %v", recordSize, err)
+				}
+				if found != tt.wantFound || got != tt.want {
+					t.Errorf("Lookup() record size %d got = %v, %v, want %v, %v", recordSize, got, found, tt.want, tt.wantFound)
+				}
+			})
+		}
+	}
+}
+
+func Test_mmdbDecoder_decode(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{"short string", "DE", "DE"},
+		{"string with one size byte", strings.Repeat("a", 100), strings.Repeat("a", 100)},
+		{"string with two size bytes", strings.Repeat("b", 1000), strings.Repeat("b", 1000)},
+		{"string with three size bytes", strings.Repeat("c", 70000), strings.Repeat("c", 70000)},
+		{"bytes", []byte{1, 2, 3}, []byte{1, 2, 3}},
+		{"double", 52.5, 52.5},
+		{"float", float32(1.5), float32(1.5)},
+		{"uint16", uint16(443), uint64(443)},
+		{"uint32 zero", uint32(0), uint64(0)},
+		{"uint64", uint64(1) << 40, uint64(1) << 40},
+		{"uint128", new(big.Int).Lsh(big.NewInt(1), 100), new(big.Int).Lsh(big.NewInt(1), 100)},
+		{"negative int32", int32(-5), int32(-5)},
+		{"true", true, true},
+		{"false", false, false},
+		{"array", []interface{}{"en", uint16(1)}, []interface{}{"en", uint64(1)}},
+		{"nested map", map[string]interface{}{"names": map[string]interface{}{"en": "Germany"}}, map[string]interface{}{"names": map[string]interface{}{"en": "Germany"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := mmdbTestWriter{}
+			w.encode(tt.value)
+			got, next, err := mmdbDecoder{w.Bytes()}.decode(0, 0)
+			if err != nil {
+				t.Fatalf("decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decode() got = %v, want %v", got, tt.want)
+			}
+			if next != uint(w.Len()) {
+				t.Errorf("decode() next = %d, want %d", next, w.Len())
+			}
+		})
+	}
+}
+
+func Test_mmdbDecoder_pointers(t *testing.T) {
+	for _, offset := range []uint{10, 3000, 600000} {
+		w := mmdbTestWriter{}
+		w.Write(make([]byte, offset))
+		w.encode("target")
+		pointerOffset := uint(w.Len())
+		w.encode(mmdbTestPointer(offset))
+		got, next, err := mmdbDecoder{w.Bytes()}.decode(pointerOffset, 0)
+		if err != nil || got != "target" || next != uint(w.Len()) {
+			t.Errorf("decode() pointer to %d got = %v, %d, %v", offset, got, next, err)
+		}
+	}
+
+	w := mmdbTestWriter{}
+	w.encode(mmdbTestPointer(0))
+	if _, _, err := (mmdbDecoder{w.Bytes()}).decode(0, 0); err == nil {
+		t.Errorf("decode() pointer to itself: expected error")
+	}
+}
+
+func Test_newGeoDB_invalid(t *testing.T) {
+	data, networks := testGeoData()
+	valid := buildTestMMDB(24, data, networks)
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{"empty file", nil},
+		{"no metadata", valid[:len(valid)/2]},
+		{"unsupported record size", buildTestMMDB(20, data, networks)},
+		{"truncated search tree", valid[bytes.LastIndex(valid, mmdbMetadataMarker)-20:]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newGeoDB(tt.content); err == nil {
+				t.Errorf("newGeoDB() expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"mime"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+//Predicate is a condition on a request that decides whether a middleware is applied, see Middleware.When.
+//Predicates can be combined with And, Or and Not.
+type Predicate func(r *http.Request) bool
+
+//PathPrefix is satisfied if the path of the request starts with any of the prefixes. Prefixes match whole
+//path segments only: "/health" matches "/health" and "/health/live", but not "/health-admin".
+func PathPrefix(prefixes ...string) Predicate {
+	return func(r *http.Request) bool {
+		path := r.URL.Path
+		for _, prefix := range prefixes {
+			if path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/") {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//PathGlob is satisfied if the path of the request matches any of the patterns, in which * matches any
+//sequence of characters except /, ** matches any sequence of characters and ? matches a single character except /:
+//  middleware.PathGlob("/hooks/*", "/static/**.js")
+func PathGlob(patterns ...string) Predicate {
+	var expressions []*regexp.Regexp
+	for _, pattern := range patterns {
+		var expression strings.Builder
+		expression.WriteString("^")
+		for i := 0; i < len(pattern); i++ {
+			switch {
+			case strings.HasPrefix(pattern[i:], "**"):
+				expression.WriteString(".*")
+				i++
+			case pattern[i] == '*':
+				expression.WriteString("[^/]*")
+			case pattern[i] == '?':
+				expression.WriteString("[^/]")
+			default:
+				expression.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			}
+		}
+		expression.WriteString("$")
+		expressions = append(expressions, regexp.MustCompile(expression.String()))
+	}
+	return func(r *http.Request) bool {
+		for _, expression := range expressions {
+			if expression.MatchString(r.URL.Path) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//Method is satisfied if the request has any of the methods
+func Method(methods ...string) Predicate {
+	return func(r *http.Request) bool {
+		return containsFold(methods, r.Method)
+	}
+}
+
+//Host is satisfied if the host of the request (without port) is any of the hosts.
+//Hosts may start with "*." to match a single label, e.g. "*.example.org" matches "api.example.org".
+func Host(hosts ...string) Predicate {
+	return func(r *http.Request) bool {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		for _, pattern := range hosts {
+			if matchDNSName(pattern, host) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//HasHeader is satisfied if the request has the header, regardless of its value
+func HasHeader(name string) Predicate {
+	return Headers(HeaderPresent(name))
+}
+
+//Headers is satisfied if the headers of the request satisfy the rule
+func Headers(rule HeaderRule) Predicate {
+	return func(r *http.Request) bool {
+		return rule(r.Header)
+	}
+}
+
+//ContentType is satisfied if the media type of the request body is any of the types, ignoring parameters
+//such as the charset. Types may end with "/*" to match all subtypes, e.g. "text/*".
+func ContentType(types ...string) Predicate {
+	return func(r *http.Request) bool {
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			return false
+		}
+		for _, t := range types {
+			t = strings.ToLower(t)
+			if t == mediaType || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(t, "*"))) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//And returns a predicate that is satisfied if predicate and all others are satisfied
+func (predicate Predicate) And(others ...Predicate) Predicate {
+	return func(r *http.Request) bool {
+		if !predicate(r) {
+			return false
+		}
+		for _, other := range others {
+			if !other(r) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+//Or returns a predicate that is satisfied if predicate or any of the others is satisfied
+func (predicate Predicate) Or(others ...Predicate) Predicate {
+	return func(r *http.Request) bool {
+		if predicate(r) {
+			return true
+		}
+		for _, other := range others {
+			if other(r) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//Not returns a predicate that is satisfied if predicate is not
+func (predicate Predicate) Not() Predicate {
+	return func(r *http.Request) bool {
+		return !predicate(r)
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPredicates(t *testing.T) {
+	request := func(method string, target string, header http.Header) *http.Request {
+		r := httptest.NewRequest(method, target, nil)
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		return r
+	}
+	hook := request("POST", "http://api.example.org:8080/hooks/github", http.Header{"Content-Type": {"application/json; charset=utf-8"}, "X-Hub-Signature": {"sha1=abc"}})
+	asset := request("GET", "http://www.example.org/static/js/app.min.js", nil)
+
+	tests := []struct {
+		name      string
+		predicate Predicate
+		request   *http.Request
+		want      bool
+	}{
+		{"path prefix", PathPrefix("/admin", "/hooks/"), hook, true},
+		{"path prefix mismatch", PathPrefix("/admin"), hook, false},
+		{"path prefix without trailing slash", PathPrefix("/hooks"), hook, true},
+		{"path prefix matches whole segments", PathPrefix("/health"), request("POST", "/health-admin/delete", nil), false},
+		{"path prefix with trailing slash requires it", PathPrefix("/health/"), request("GET", "/health", nil), false},
+		{"glob", PathGlob("/hooks/*"), hook, true},
+		{"glob does not cross segments", PathGlob("/static/*.js"), asset, false},
+		{"double star glob", PathGlob("/static/**.js"), asset, true},
+		{"question mark glob", PathGlob("/hooks/githu?"), hook, true},
+		{"glob quotes other characters", PathGlob("/static/js/app?min.js", "/static/js/app.min.j"), asset, true},
+		{"method", Method("PUT", "POST"), hook, true},
+		{"method mismatch", Method("POST"), asset, false},
+		{"host without port", Host("api.example.org"), hook, true},
+		{"wildcard host", Host("*.example.org"), asset, true},
+		{"host mismatch", Host("example.org"), asset, false},
+		{"header present", HasHeader("X-Hub-Signature"), hook, true},
+		{"header absent", HasHeader("X-Hub-Signature"), asset, false},
+		{"header rule", Headers(HeaderMatches("X-Hub-Signature", ValuePrefix("sha1="))), hook, true},
+		{"content type with parameters", ContentType("application/json"), hook, true},
+		{"content type wildcard", ContentType("text/*", "Application/*"), hook, true},
+		{"content type missing", ContentType("application/json"), asset, false},
+		{"and", Method("POST").And(PathGlob("/hooks/*")), hook, true},
+		{"and not satisfied", Method("POST").And(PathGlob("/hooks/*")), asset, false},
+		{"or", Method("POST").Or(PathPrefix("/static/")), asset, true},
+		{"not", PathPrefix("/static/").Not(), hook, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.predicate(tt.request); got != tt.want {
+				t.Errorf("predicate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+//Principal is the authenticated caller of a request. It is published by all authenticating filters,
+//in addition to their specific identity (e.g. JWTClaimsFromContext), so that authorization does not depend
+//on how the caller was authenticated. Method is one of "api-key", "jwt", "introspection", "basic",
+//"client-cert" or "hmac".
+type Principal struct {
+	Subject string
+	Method  string
+	Scopes  []string
+	Roles   []string
+}
+
+//HasScope reports whether the principal has the scope
+func (p Principal) HasScope(scope string) bool {
+	return contains(p.Scopes, scope)
+}
+
+//HasRole reports whether the principal has the role
+func (p Principal) HasRole(role string) bool {
+	return contains(p.Roles, role)
+}
+
+//PrincipalFromContext returns the caller authenticated by one of the filters
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey).(Principal)
+	return principal, ok
+}
+
+//withIdentity returns the request with the filter specific identity and the principal stored in its context
+func withIdentity(r *http.Request, key contextKey, identity interface{}, principal Principal) *http.Request {
+	ctx := context.WithValue(r.Context(), key, identity)
+	ctx = context.WithValue(ctx, principalKey, principal)
+	recordPrincipal(ctx, principal)
+	return r.WithContext(ctx)
+}
+
+//jwtPrincipal takes the scopes from the claims scope (space separated) or scp (space separated or list),
+//and the roles from the claim roles
+func jwtPrincipal(claims JWTClaims) Principal {
+	principal := Principal{Subject: claims.Subject, Method: "jwt"}
+	principal.Scopes = append(claimStrings(claims.Raw["scope"]), claimStrings(claims.Raw["scp"])...)
+	principal.Roles = claimStrings(claims.Raw["roles"])
+	return principal
+}
+
+func claimStrings(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		var values []string
+		for _, element := range value {
+			if s, ok := element.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func introspectionPrincipal(introspection TokenIntrospection) Principal {
+	subject := introspection.Subject
+	if subject == "" {
+		subject = introspection.Username
+	}
+	if subject == "" {
+		subject = introspection.ClientID
+	}
+	return Principal{Subject: subject, Method: "introspection", Scopes: introspection.Scopes()}
+}
+
+func clientCertPrincipal(identity ClientCertIdentity) Principal {
+	subject := identity.SPIFFEID
+	if subject == "" {
+		subject = identity.CommonName
+	}
+	return Principal{Subject: subject, Method: "client-cert"}
+}
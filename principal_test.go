@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func Test_jwtPrincipal(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  map[string]interface{}
+		want Principal
+	}{
+		{"scope", map[string]interface{}{"scope": "orders:read orders:write"},
+			Principal{Subject: "alice", Method: "jwt", Scopes: []string{"orders:read", "orders:write"}}},
+		{"scp list and roles", map[string]interface{}{"scp": []interface{}{"orders:read"}, "roles": []interface{}{"admin", 42}},
+			Principal{Subject: "alice", Method: "jwt", Scopes: []string{"orders:read"}, Roles: []string{"admin"}}},
+		{"no scopes", map[string]interface{}{}, Principal{Subject: "alice", Method: "jwt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jwtPrincipal(JWTClaims{Subject: "alice", Raw: tt.raw}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("jwtPrincipal() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_introspectionPrincipal(t *testing.T) {
+	tests := []struct {
+		name          string
+		introspection TokenIntrospection
+		wantSubject   string
+	}{
+		{"subject", TokenIntrospection{Subject: "alice", Username: "Alice", ClientID: "app"}, "alice"},
+		{"username", TokenIntrospection{Username: "Alice", ClientID: "app"}, "Alice"},
+		{"client", TokenIntrospection{ClientID: "app", Scope: "orders:read"}, "app"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := introspectionPrincipal(tt.introspection)
+			if got.Subject != tt.wantSubject || got.Method != "introspection" || !reflect.DeepEqual(got.Scopes, tt.introspection.Scopes()) {
+				t.Errorf("introspectionPrincipal() = %+v", got)
+			}
+		})
+	}
+}
+
+func TestPrincipalFromContext(t *testing.T) {
+	keys := []APIKey{{Name: "ci", Hash: HashAPIKey("ci-secret"), Scopes: []string{"deploy"}, Roles: []string{"automation"}}}
+	hmacParams := HmacParams{Secret: hex.EncodeToString([]byte("secret")), HmacSource: "X-Signature", Encoding: "hex", KeyID: "webhook"}
+	signature := hmac.New(sha256.New, []byte("secret")).Sum(nil)
+
+	tests := []struct {
+		name    string
+		filter  Middleware
+		request func(*http.Request)
+		want    Principal
+	}{
+		{"API key", APIKeyFilter(APIKeyParams{Keys: keys}), func(r *http.Request) { r.Header.Set("X-API-Key", "ci-secret") },
+			Principal{Subject: "ci", Method: "api-key", Scopes: []string{"deploy"}, Roles: []string{"automation"}}},
+		{"HMAC", HmacFilter(hmacParams), func(r *http.Request) { r.Header.Set("X-Signature", hex.EncodeToString(signature)) },
+			Principal{Subject: "webhook", Method: "hmac"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var principal Principal
+			handler := tt.filter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				principal, _ = PrincipalFromContext(r.Context())
+			}))
+			request := httptest.NewRequest("POST", "/", nil)
+			tt.request(request)
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+			if !reflect.DeepEqual(principal, tt.want) {
+				t.Errorf("PrincipalFromContext() = %+v, want %+v", principal, tt.want)
+			}
+		})
+	}
+}
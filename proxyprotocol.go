@@ -0,0 +1,222 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//proxyV2Signature starts every PROXY protocol version 2 header
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+//ProxyListener is a net.Listener that accepts PROXY protocol version 1 (text) and version 2 (binary) headers,
+//as sent by TCP load balancers like HAProxy or AWS NLB. For connections from Upstreams that start with such a header,
+//RemoteAddr returns the address of the original client, so that IPFilter and the other filters see the real client
+//without having to trust a header. Connections from other addresses are passed on unchanged.
+//  listener, err := net.Listen("tcp", ":8080")
+//  proxyListener, err := middleware.NewProxyListener(listener, []string{"10.0.0.0/24"})
+//  log.Fatal(http.Serve(proxyListener, mux))
+type ProxyListener struct {
+	net.Listener
+	Upstreams     *IPList
+	HeaderTimeout time.Duration //maximum time to wait for the header, default 10 seconds
+}
+
+//NewProxyListener wraps listener to accept PROXY protocol headers from the given upstream ip ranges,
+//which have the same format as for IPFilter
+func NewProxyListener(listener net.Listener, upstreamRanges []string) (*ProxyListener, error) {
+	upstreams, err := NewIPList(upstreamRanges)
+	if err != nil {
+		return nil, err
+	}
+	return &ProxyListener{Listener: listener, Upstreams: upstreams, HeaderTimeout: 10 * time.Second}, nil
+}
+
+//Accept waits for the next connection. The PROXY protocol header is read on the first call of
+//Read, RemoteAddr or LocalAddr of the connection, so that slow clients do not block Accept.
+func (pl *ProxyListener) Accept() (net.Conn, error) {
+	conn, err := pl.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	trusted, _ := pl.Upstreams.Contains(conn.RemoteAddr().String())
+	if !trusted {
+		return conn, nil
+	}
+	timeout := pl.HeaderTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &proxyConn{Conn: conn, reader: bufio.NewReader(conn), timeout: timeout}, nil
+}
+
+type proxyConn struct {
+	net.Conn
+	reader     *bufio.Reader
+	timeout    time.Duration
+	once       sync.Once
+	remoteAddr net.Addr
+	localAddr  net.Addr
+	err        error
+}
+
+func (pc *proxyConn) readHeader() {
+	pc.once.Do(func() {
+		pc.Conn.SetReadDeadline(time.Now().Add(pc.timeout))
+		pc.remoteAddr, pc.localAddr, pc.err = readProxyHeader(pc.reader)
+		pc.Conn.SetReadDeadline(time.Time{})
+		if pc.err != nil {
+			pc.err = fmt.Errorf("invalid PROXY protocol header from %s: %w", pc.Conn.RemoteAddr(), pc.err)
+		}
+	})
+}
+
+func (pc *proxyConn) Read(b []byte) (int, error) {
+	pc.readHeader()
+	if pc.err != nil {
+		return 0, pc.err
+	}
+	return pc.reader.Read(b)
+}
+
+func (pc *proxyConn) RemoteAddr() net.Addr {
+	pc.readHeader()
+	if pc.remoteAddr != nil {
+		return pc.remoteAddr
+	}
+	return pc.Conn.RemoteAddr()
+}
+
+func (pc *proxyConn) LocalAddr() net.Addr {
+	pc.readHeader()
+	if pc.localAddr != nil {
+		return pc.localAddr
+	}
+	return pc.Conn.LocalAddr()
+}
+
+//readProxyHeader reads a PROXY protocol header, if the connection starts with one. The returned addresses
+//are nil if there is no header or the header does not contain addresses (v1 UNKNOWN, v2 LOCAL or UNSPEC).
+func readProxyHeader(r *bufio.Reader) (source net.Addr, destination net.Addr, err error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		if err == io.EOF {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	switch first[0] {
+	case 'P':
+		start, err := r.Peek(6)
+		if err == nil && string(start) == "PROXY " {
+			return readProxyV1(r)
+		}
+	case proxyV2Signature[0]:
+		start, err := r.Peek(len(proxyV2Signature))
+		if err == nil && bytes.Equal(start, proxyV2Signature) {
+			return readProxyV2(r)
+		}
+	}
+	return nil, nil, nil
+}
+
+//readProxyV1 reads a header like "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"
+func readProxyV1(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	var line []byte
+	for len(line) < 107 { // maximum length of a v1 header
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, fmt.Errorf("v1 header too long or not terminated by CRLF")
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, fmt.Errorf("invalid v1 header %q", line)
+	}
+	source, err := parseProxyV1Address(fields[1], fields[2], fields[4])
+	if err != nil {
+		return nil, nil, err
+	}
+	destination, err := parseProxyV1Address(fields[1], fields[3], fields[5])
+	if err != nil {
+		return nil, nil, err
+	}
+	return source, destination, nil
+}
+
+func parseProxyV1Address(protocol string, address string, port string) (net.Addr, error) {
+	ip := net.ParseIP(address)
+	if ip == nil || (protocol == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("invalid %s address %s", protocol, address)
+	}
+	portNumber, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || (len(port) > 1 && port[0] == '0') {
+		return nil, fmt.Errorf("invalid port %s", port)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(portNumber)}, nil
+}
+
+//readProxyV2 reads a binary header: signature, version and command, address family and protocol,
+//length of the rest of the header, addresses and optional TLVs
+func readProxyV2(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+	version, command := header[12]>>4, header[12]&0x0F
+	family, protocol := header[13]>>4, header[13]&0x0F
+	length := binary.BigEndian.Uint16(header[14:16])
+	if version != 2 {
+		return nil, nil, fmt.Errorf("unsupported version %d", version)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, err
+	}
+
+	switch command {
+	case 0x0: // LOCAL: connection established by the proxy itself, e.g. for health checks
+		return nil, nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, nil, fmt.Errorf("unsupported command %d", command)
+	}
+
+	var addressLength int
+	switch family {
+	case 0x1: // AF_INET
+		addressLength = 4
+	case 0x2: // AF_INET6
+		addressLength = 16
+	default: // AF_UNSPEC or AF_UNIX
+		return nil, nil, nil
+	}
+	if len(payload) < 2*addressLength+4 {
+		return nil, nil, fmt.Errorf("address block too short")
+	}
+	sourceIP := net.IP(payload[:addressLength])
+	destinationIP := net.IP(payload[addressLength : 2*addressLength])
+	sourcePort := int(binary.BigEndian.Uint16(payload[2*addressLength:]))
+	destinationPort := int(binary.BigEndian.Uint16(payload[2*addressLength+2:]))
+	if protocol == 0x2 { // DGRAM
+		return &net.UDPAddr{IP: sourceIP, Port: sourcePort}, &net.UDPAddr{IP: destinationIP, Port: destinationPort}, nil
+	}
+	return &net.TCPAddr{IP: sourceIP, Port: sourcePort}, &net.TCPAddr{IP: destinationIP, Port: destinationPort}, nil
+}
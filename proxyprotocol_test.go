@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func proxyV2Header(command byte, family byte, addresses []byte) []byte {
+	header := append([]byte(nil), proxyV2Signature...)
+	header = append(header, 0x20|command, family, byte(len(addresses)>>8), byte(len(addresses)))
+	return append(header, addresses...)
+}
+
+func Test_readProxyHeader(t *testing.T) {
+	ipv4Addresses := []byte{192, 168, 0, 1, 10, 0, 0, 1, 0xDC, 0x04, 0x01, 0xBB}
+	ipv6Addresses := append(append(net.ParseIP("2001:db8::1").To16(), net.ParseIP("2001:db8::2").To16()...), 0x1F, 0x90, 0x00, 0x50)
+	tlv := []byte{0x04, 0x00, 0x01, 0xFF}
+
+	tests := []struct {
+		name            string
+		input           []byte
+		wantSource      string
+		wantDestination string
+		wantRest        string
+		wantErr         bool
+	}{
+		{"v1 TCP4", []byte("PROXY TCP4 192.168.0.1 10.0.0.1 56324 443\r\nGET /"), "192.168.0.1:56324", "10.0.0.1:443", "GET /", false},
+		{"v1 TCP6", []byte("PROXY TCP6 2001:db8::1 2001:db8::2 8080 80\r\n"), "[2001:db8::1]:8080", "[2001:db8::2]:80", "", false},
+		{"v1 UNKNOWN", []byte("PROXY UNKNOWN\r\nGET /"), "", "", "GET /", false},
+		{"v1 wrong family", []byte("PROXY TCP4 2001:db8::1 2001:db8::2 8080 80\r\n"), "", "", "", true},
+		{"v1 invalid port", []byte("PROXY TCP4 192.168.0.1 10.0.0.1 99999 443\r\n"), "", "", "", true},
+		{"v1 missing CRLF", []byte("PROXY TCP4 192.168.0.1 10.0.0.1 56324 443\n"), "", "", "", true},
+		{"v1 too long", []byte("PROXY TCP4 " + strings.Repeat("1", 200)), "", "", "", true},
+		{"v2 IPv4", append(proxyV2Header(0x1, 0x11, ipv4Addresses), "GET /"...), "192.168.0.1:56324", "10.0.0.1:443", "GET /", false},
+		{"v2 IPv6", proxyV2Header(0x1, 0x21, ipv6Addresses), "[2001:db8::1]:8080", "[2001:db8::2]:80", "", false},
+		{"v2 with TLV", append(proxyV2Header(0x1, 0x11, append(ipv4Addresses, tlv...)), "GET /"...), "192.168.0.1:56324", "10.0.0.1:443", "GET /", false},
+		{"v2 LOCAL", append(proxyV2Header(0x0, 0x00, nil), "GET /"...), "", "", "GET /", false},
+		{"v2 UNIX", proxyV2Header(0x1, 0x31, make([]byte, 216)), "", "", "", false},
+		{"v2 short address block", proxyV2Header(0x1, 0x11, ipv4Addresses[:8]), "", "", "", true},
+		{"v2 truncated", proxyV2Header(0x1, 0x11, ipv4Addresses)[:20], "", "", "", true},
+		{"v2 unknown command", proxyV2Header(0x2, 0x11, ipv4Addresses), "", "", "", true},
+		{"no header", []byte("GET / HTTP/1.1\r\n"), "", "", "GET / HTTP/1.1\r\n", false},
+		{"similar to header", []byte("POST / HTTP/1.1\r\n"), "", "", "POST / HTTP/1.1\r\n", false},
+		{"empty connection", nil, "", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := bufio.NewReader(bytes.NewReader(tt.input))
+			source, destination, err := readProxyHeader(reader)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readProxyHeader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if addrString(source) != tt.wantSource || addrString(destination) != tt.wantDestination {
+				t.Errorf("readProxyHeader() got %v, %v, want %s, %s", source, destination, tt.wantSource, tt.wantDestination)
+			}
+			if rest, _ := ioutil.ReadAll(reader); string(rest) != tt.wantRest {
+				t.Errorf("readProxyHeader() remaining data %q, want %q", rest, tt.wantRest)
+			}
+		})
+	}
+}
+
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
+
+func TestProxyListener(t *testing.T) {
+	tests := []struct {
+		name      string
+		upstreams []string
+		header    string
+		want      string
+	}{
+		{"trusted upstream with header", []string{"localhost"}, "PROXY TCP4 203.0.113.7 10.0.0.1 40000 80\r\n", "203.0.113.7"},
+		{"trusted upstream without header", []string{"localhost"}, "", "127.0.0.1"},
+		{"untrusted upstream", []string{"10.0.0.0/8"}, "PROXY TCP4 203.0.113.7 10.0.0.1 40000 80\r\n", "400"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			proxyListener, err := NewProxyListener(listener, tt.upstreams)
+			if err != nil {
+				t.Fatal(err)
+			}
+			server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, getIpFromString(r.RemoteAddr))
+			})}
+			go server.Serve(proxyListener)
+			defer server.Close()
+
+			conn, err := net.Dial("tcp", listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			fmt.Fprintf(conn, "%sGET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n", tt.header)
+			response, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := ioutil.ReadAll(response.Body)
+			got := string(body)
+			if response.StatusCode != 200 {
+				got = fmt.Sprint(response.StatusCode)
+			}
+			if got != tt.want {
+				t.Errorf("ProxyListener remote address %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyListener_invalidUpstreams(t *testing.T) {
+	if _, err := NewProxyListener(nil, []string{"not an ip"}); err == nil {
+		t.Errorf("NewProxyListener() expected error")
+	}
+}
@@ -0,0 +1,288 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//RateLimitParams configures RateLimiter.
+//Algorithm is one of "token-bucket" (default), "sliding-window" or "gcra". Each client may send Limit requests
+//per Period. With "token-bucket" and "gcra", up to Burst requests (default Limit) may be sent at once.
+//Clients are identified by the result of KeyFunc if set, otherwise by the value of KeyHeader (e.g. an API key)
+//if set and present, and by their ip address otherwise. Only a SHA-256 hash of the KeyHeader value is kept.
+//IPHeader has the same meaning as the header parameter of IPFilter; requests without it are denied.
+//At most MaxKeys clients (default 10000) are tracked. If more clients are seen, the least recently seen are forgotten.
+type RateLimitParams struct {
+	Algorithm string
+	Limit     int
+	Period    time.Duration
+	Burst     int
+	KeyFunc   func(*http.Request) string
+	KeyHeader string
+	IPHeader  string
+	MaxKeys   int
+}
+
+type rateLimiter struct {
+	next   http.Handler
+	params RateLimitParams
+	store  *rateLimitStore
+}
+
+//rateDecision is the result of checking a request against the rate limit of its client
+type rateDecision struct {
+	allowed    bool
+	limit      int
+	remaining  int
+	reset      time.Duration //until the client may send limit requests again
+	retryAfter time.Duration //until the next request is allowed, if denied
+}
+
+//rateState is the state of a single client for one of the rate limiting algorithms
+type rateState interface {
+	take(now time.Time) rateDecision
+	//expires returns the time at which the state is equivalent to that of an unknown client
+	expires() time.Time
+}
+
+func (rl rateLimiter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, ok := rl.key(r)
+	if !ok {
+		denyMissingIPHeader(w, r, "ratelimit", rl.params.IPHeader)
+		return
+	}
+	decision := rl.store.take(key)
+
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(decision.limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(decision.remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.reset)))
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", rl.params.Limit, ceilSeconds(rl.params.Period)))
+	if decision.allowed {
+		rl.next.ServeHTTP(w, r)
+	} else {
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(decision.retryAfter)))
+		WriteError(w, r, &DeniedError{Status: 429, Filter: "ratelimit", Code: "rate_limited", Reason: fmt.Sprintf("client %s exceeded the rate limit", key)})
+	}
+}
+
+//key identifies the client of a request. ok is false if the client ip is required, but IPHeader is missing.
+//Key header values are hashed, so that secrets like API keys are neither stored nor logged.
+func (rl rateLimiter) key(r *http.Request) (key string, ok bool) {
+	if rl.params.KeyFunc != nil {
+		return rl.params.KeyFunc(r), true
+	}
+	if rl.params.KeyHeader != "" {
+		if value := r.Header.Get(rl.params.KeyHeader); value != "" {
+			sum := sha256.Sum256([]byte(value))
+			return "key:" + hex.EncodeToString(sum[:]), true
+		}
+	}
+	ip, ok := clientIP(r, rl.params.IPHeader)
+	if !ok {
+		return "", false
+	}
+	return "ip:" + normalizeIP(ip), true
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+//RateLimiter limits the number of requests each client may send. Requests exceeding the limit are answered
+//with 429 Too Many Requests and a Retry-After header. All responses carry RateLimit-Limit, RateLimit-Remaining,
+//RateLimit-Reset and RateLimit-Policy headers:
+//  perAPIKey := middleware.RateLimiter(middleware.RateLimitParams{
+//  	Algorithm: "gcra",
+//  	Limit:     100,
+//  	Period:    time.Minute,
+//  	KeyHeader: "X-API-Key",
+//  })
+func RateLimiter(params RateLimitParams) func(http.Handler) http.Handler {
+	newState, err := rateStateFactory(params)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to create rate limiter %s", err))
+	}
+	if params.MaxKeys <= 0 {
+		params.MaxKeys = 10000
+	}
+	params.KeyHeader = textproto.CanonicalMIMEHeaderKey(params.KeyHeader)
+	params.IPHeader = textproto.CanonicalMIMEHeaderKey(params.IPHeader)
+	store := newRateLimitStore(params.MaxKeys, newState)
+	fn := func(next http.Handler) http.Handler {
+		return rateLimiter{next, params, store}
+	}
+	return fn
+}
+
+func rateStateFactory(params RateLimitParams) (func(now time.Time) rateState, error) {
+	if params.Limit <= 0 || params.Period <= 0 {
+		return nil, fmt.Errorf("limit and period must be positive")
+	}
+	burst := params.Burst
+	if burst <= 0 {
+		burst = params.Limit
+	}
+	interval := params.Period / time.Duration(params.Limit)
+	if interval <= 0 {
+		return nil, fmt.Errorf("period %s is too short for a limit of %d", params.Period, params.Limit)
+	}
+	switch strings.ToLower(params.Algorithm) {
+	case "", "token-bucket":
+		return func(now time.Time) rateState {
+			return &tokenBucket{capacity: float64(burst), interval: interval, tokens: float64(burst), last: now}
+		}, nil
+	case "sliding-window":
+		return func(now time.Time) rateState {
+			return &slidingWindow{limit: params.Limit, period: params.Period}
+		}, nil
+	case "gcra":
+		return func(now time.Time) rateState {
+			return &gcra{burst: burst, interval: interval, tat: now}
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid algorithm %s", params.Algorithm)
+	}
+}
+
+//tokenBucket refills one token per interval up to capacity, each request takes one token
+type tokenBucket struct {
+	capacity float64
+	interval time.Duration
+	tokens   float64
+	last     time.Time
+}
+
+func (tb *tokenBucket) take(now time.Time) rateDecision {
+	if elapsed := now.Sub(tb.last); elapsed > 0 {
+		tb.tokens = math.Min(tb.capacity, tb.tokens+float64(elapsed)/float64(tb.interval))
+		tb.last = now
+	}
+	decision := rateDecision{limit: int(tb.capacity)}
+	if tb.tokens >= 1 {
+		tb.tokens--
+		decision.allowed = true
+	} else {
+		decision.retryAfter = time.Duration((1 - tb.tokens) * float64(tb.interval))
+	}
+	decision.remaining = int(tb.tokens)
+	decision.reset = time.Duration((tb.capacity - tb.tokens) * float64(tb.interval))
+	return decision
+}
+
+func (tb *tokenBucket) expires() time.Time {
+	return tb.last.Add(time.Duration((tb.capacity - tb.tokens) * float64(tb.interval)))
+}
+
+//slidingWindow permits limit requests within any period by keeping a log of the times of permitted requests
+type slidingWindow struct {
+	limit  int
+	period time.Duration
+	log    []time.Time
+}
+
+func (sw *slidingWindow) take(now time.Time) rateDecision {
+	windowStart := now.Add(-sw.period)
+	expired := 0
+	for expired < len(sw.log) && !sw.log[expired].After(windowStart) {
+		expired++
+	}
+	sw.log = sw.log[expired:]
+
+	decision := rateDecision{limit: sw.limit}
+	if len(sw.log) < sw.limit {
+		sw.log = append(sw.log, now)
+		decision.allowed = true
+	} else {
+		decision.retryAfter = sw.log[0].Add(sw.period).Sub(now)
+	}
+	decision.remaining = sw.limit - len(sw.log)
+	decision.reset = sw.expires().Sub(now)
+	return decision
+}
+
+func (sw *slidingWindow) expires() time.Time {
+	if len(sw.log) == 0 {
+		return time.Time{}
+	}
+	return sw.log[len(sw.log)-1].Add(sw.period)
+}
+
+//gcra implements the generic cell rate algorithm, which tracks the theoretical arrival time (tat)
+//of the next request, if requests were sent exactly once per interval
+type gcra struct {
+	burst    int
+	interval time.Duration
+	tat      time.Time
+}
+
+func (g *gcra) take(now time.Time) rateDecision {
+	tat := g.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	newTat := tat.Add(g.interval)
+	allowAt := newTat.Add(-time.Duration(g.burst) * g.interval)
+
+	decision := rateDecision{limit: g.burst}
+	if now.Before(allowAt) {
+		decision.retryAfter = allowAt.Sub(now)
+		decision.reset = tat.Sub(now)
+		return decision
+	}
+	g.tat = newTat
+	decision.allowed = true
+	decision.remaining = int(now.Sub(allowAt) / g.interval)
+	decision.reset = newTat.Sub(now)
+	return decision
+}
+
+func (g *gcra) expires() time.Time {
+	return g.tat
+}
+
+//rateLimitStore keeps the rate limiting state of at most maxKeys clients in least recently used order.
+//States that have expired are removed, as they do not differ from the state of an unknown client.
+type rateLimitStore struct {
+	mutex    sync.Mutex
+	newState func(now time.Time) rateState
+	states   *lruCache
+	now      func() time.Time
+}
+
+func newRateLimitStore(maxKeys int, newState func(now time.Time) rateState) *rateLimitStore {
+	expires := func(state interface{}) time.Time { return state.(rateState).expires() }
+	return &rateLimitStore{
+		newState: newState,
+		states:   newLRUCache(maxKeys, expires),
+		now:      time.Now,
+	}
+}
+
+func (s *rateLimitStore) take(key string) rateDecision {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := s.now()
+
+	state, ok := s.states.get(key, now)
+	if !ok {
+		state = s.newState(now)
+	}
+	decision := state.(rateState).take(now)
+	// the state is added after take, as a new state only expires once it has been used
+	s.states.add(key, state, now)
+	return decision
+}
+
+func (s *rateLimitStore) len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.states.len()
+}
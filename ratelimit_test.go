@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_rateStates(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	type step struct {
+		after         time.Duration //since start
+		wantAllowed   bool
+		wantRemaining int
+	}
+	tests := []struct {
+		name   string
+		params RateLimitParams
+		steps  []step
+	}{
+		{"token bucket", RateLimitParams{Limit: 2, Period: 2 * time.Second},
+			[]step{{0, true, 1}, {0, true, 0}, {0, false, 0}, {time.Second, true, 0}, {1500 * time.Millisecond, false, 0}, {5 * time.Second, true, 1}}},
+		{"token bucket with burst", RateLimitParams{Limit: 1, Period: time.Second, Burst: 3},
+			[]step{{0, true, 2}, {0, true, 1}, {0, true, 0}, {0, false, 0}, {time.Second, true, 0}}},
+		{"sliding window", RateLimitParams{Algorithm: "sliding-window", Limit: 2, Period: 10 * time.Second},
+			[]step{{0, true, 1}, {5 * time.Second, true, 0}, {9 * time.Second, false, 0}, {10 * time.Second, true, 0}, {10*time.Second + 1, false, 0}, {15*time.Second + 1, true, 0}}},
+		{"gcra", RateLimitParams{Algorithm: "GCRA", Limit: 2, Period: 2 * time.Second},
+			[]step{{0, true, 1}, {0, true, 0}, {0, false, 0}, {time.Second, true, 0}, {1500 * time.Millisecond, false, 0}, {5 * time.Second, true, 1}}},
+		{"gcra with burst", RateLimitParams{Algorithm: "gcra", Limit: 1, Period: time.Second, Burst: 3},
+			[]step{{0, true, 2}, {0, true, 1}, {0, true, 0}, {0, false, 0}, {time.Second, true, 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newState, err := rateStateFactory(tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			state := newState(start)
+			for i, s := range tt.steps {
+				got := state.take(start.Add(s.after))
+				if got.allowed != s.wantAllowed || got.remaining != s.wantRemaining {
+					t.Errorf("step %d: take() got allowed %v, remaining %d, want %v, %d", i, got.allowed, got.remaining, s.wantAllowed, s.wantRemaining)
+				}
+				if !got.allowed && got.retryAfter <= 0 {
+					t.Errorf("step %d: take() denied without retryAfter", i)
+				}
+			}
+		})
+	}
+}
+
+func Test_rateStateFactory_invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		params RateLimitParams
+	}{
+		{"no limit", RateLimitParams{Period: time.Second}},
+		{"no period", RateLimitParams{Limit: 1}},
+		{"unknown algorithm", RateLimitParams{Algorithm: "leaky", Limit: 1, Period: time.Second}},
+		{"period shorter than limit", RateLimitParams{Limit: 10, Period: 5 * time.Nanosecond}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := rateStateFactory(tt.params); err == nil {
+				t.Errorf("rateStateFactory() expected error")
+			}
+		})
+	}
+}
+
+func Test_rateLimitStore(t *testing.T) {
+	newState, _ := rateStateFactory(RateLimitParams{Limit: 1, Period: time.Second})
+	now := time.Unix(1600000000, 0)
+	store := newRateLimitStore(2, newState)
+	store.now = func() time.Time { return now }
+
+	store.take("a")
+	store.take("b")
+	if !store.take("c").allowed {
+		t.Errorf("take() new client should be allowed")
+	}
+	if store.len() != 2 {
+		t.Errorf("len() = %d, store should be bounded to 2 entries", store.len())
+	}
+	if !store.take("a").allowed {
+		t.Errorf("take() least recently used client should have been forgotten")
+	}
+	if store.take("c").allowed {
+		t.Errorf("take() recently used client should be limited")
+	}
+
+	now = now.Add(2 * time.Second)
+	store.take("d")
+	if store.len() != 1 {
+		t.Errorf("len() = %d, expired entries should be removed", store.len())
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := RateLimiter(RateLimitParams{Limit: 2, Period: time.Minute, KeyHeader: "x-api-key", IPHeader: "X-Forwarded-For"})
+	handler := limiter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	send := func(remoteAddr string, headers map[string]string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.RemoteAddr = remoteAddr
+		for key, value := range headers {
+			request.Header.Set(key, value)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	apiKey := map[string]string{"X-Api-Key": "key1"}
+	send("10.0.0.1:1000", apiKey)
+	response := send("10.0.0.2:1000", apiKey)
+	if response.Code != 200 || response.Header().Get("RateLimit-Remaining") != "0" || response.Header().Get("RateLimit-Limit") != "2" {
+		t.Errorf("second request: got %d, headers %v", response.Code, response.Header())
+	}
+	response = send("10.0.0.3:1000", apiKey)
+	if response.Code != 429 || response.Header().Get("Retry-After") != "30" {
+		t.Errorf("third request with same API key: got %d, headers %v", response.Code, response.Header())
+	}
+	if response.Header().Get("RateLimit-Policy") != "2;w=60" {
+		t.Errorf("RateLimit-Policy = %s", response.Header().Get("RateLimit-Policy"))
+	}
+
+	forwarded := map[string]string{"X-Forwarded-For": "192.168.1.1"}
+	send("10.0.0.1:1000", forwarded)
+	send("10.0.0.1:1001", forwarded)
+	if response := send("10.0.0.1:1002", forwarded); response.Code != 429 {
+		t.Errorf("third request from same client ip: got %d", response.Code)
+	}
+	if response := send("10.0.0.1:1003", map[string]string{"X-Forwarded-For": "192.168.1.2"}); response.Code != 200 {
+		t.Errorf("request from other client ip: got %d", response.Code)
+	}
+	if response := send("10.0.0.1:1004", nil); response.Code != 403 {
+		t.Errorf("request without ip header: got %d", response.Code)
+	}
+}
+
+func TestRateLimiter_hashesKey(t *testing.T) {
+	limiter := RateLimiter(RateLimitParams{Algorithm: "gcra", Limit: 2, Burst: 1, Period: time.Minute, KeyHeader: "X-Api-Key"})
+	var denied *DeniedError
+	errs := HandleErrors(ErrorParams{Render: func(w http.ResponseWriter, r *http.Request, status int, err error) {
+		errors.As(err, &denied)
+		w.WriteHeader(status)
+	}})
+	handler := errs(limiter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	var response *httptest.ResponseRecorder
+	for i := 0; i < 2; i++ {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("X-Api-Key", "secret-api-key")
+		response = httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+	}
+	if response.Code != 429 || denied == nil {
+		t.Fatalf("second request: got %d", response.Code)
+	}
+	if strings.Contains(denied.Reason, "secret-api-key") {
+		t.Errorf("Reason = %s, should not contain the API key", denied.Reason)
+	}
+	if response.Header().Get("RateLimit-Policy") != "2;w=60" {
+		t.Errorf("RateLimit-Policy = %s, want the limit instead of the burst", response.Header().Get("RateLimit-Policy"))
+	}
+}
+
+func TestRateLimiter_KeyFunc(t *testing.T) {
+	limiter := RateLimiter(RateLimitParams{Algorithm: "sliding-window", Limit: 1, Period: time.Minute,
+		KeyFunc: func(r *http.Request) string { return r.URL.Path }})
+	handler := limiter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/a", 200},
+		{"/a", 429},
+		{"/b", 200},
+	}
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", tt.path, nil))
+		if recorder.Code != tt.want {
+			t.Errorf("RateLimiter() %s got %d, want %d", tt.path, recorder.Code, tt.want)
+		}
+	}
+}
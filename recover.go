@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+//PanicError is the error written by Recover for a panic of a following handler.
+//Value is the value passed to panic, Stack the stack trace of the panicking goroutine.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+//Unwrap returns Value if it is an error
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+//RecoverParams configures Recover. OnPanic is called for every recovered panic, e.g. to report it to an error tracker.
+type RecoverParams struct {
+	OnPanic func(r *http.Request, err *PanicError)
+}
+
+type recoverFilter struct {
+	next   http.Handler
+	params RecoverParams
+}
+
+func (rf recoverFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	recorder := WrapResponseWriter(w)
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+		if err, ok := recovered.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+			panic(recovered)
+		}
+		err := &PanicError{Value: recovered, Stack: debug.Stack()}
+		if rf.params.OnPanic != nil {
+			rf.params.OnPanic(r, err)
+		}
+		eh := errorHandlerFrom(r)
+		if recorder.Status() != 0 {
+			// the client already received a status, so the connection is aborted
+			// instead of letting the truncated response appear complete
+			eh.log(r, 500, err)
+			panic(http.ErrAbortHandler)
+		}
+		eh.handle(w, r, err)
+	}()
+	rf.next.ServeHTTP(recorder, r)
+}
+
+//Recover catches panics of the following handlers. The panic is written as PanicError with WriteError, which logs
+//it with its stack and responds with 500 Internal Server Error. If the response was already started, the panic is
+//only logged and the connection is aborted. Panics with http.ErrAbortHandler are passed on unchanged.
+//It belongs at the beginning of a chain, after HandleErrors if the error should be rendered by it:
+//  recovery := middleware.Recover(middleware.RecoverParams{
+//  	OnPanic: func(r *http.Request, err *middleware.PanicError) {
+//  		tracker.Report(err.Value, err.Stack)
+//  	},
+//  })
+//  mux.Handle("/", middleware.Assemble(recovery, hmac).ApplyToFunc(handler))
+func Recover(params RecoverParams) func(http.Handler) http.Handler {
+	fn := func(next http.Handler) http.Handler {
+		return recoverFilter{next: next, params: params}
+	}
+	return fn
+}
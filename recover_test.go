@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRecover(t *testing.T) {
+	var buffer bytes.Buffer
+	log.SetOutput(&buffer)
+	defer log.SetOutput(os.Stderr)
+
+	errBroken := errors.New("broken")
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		errors     *ErrorParams
+		wantStatus int
+		wantBody   string
+		wantPanic  bool
+	}{
+		{"no panic", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "ok") }, nil, 200, "ok", false},
+		{"panic", func(w http.ResponseWriter, r *http.Request) { panic("boom") }, nil, 500, "Internal Server Error\n", true},
+		{"panic with error", func(w http.ResponseWriter, r *http.Request) { panic(errBroken) }, &ErrorParams{
+			Status: func(err error) int {
+				if errors.Is(err, errBroken) {
+					return 503
+				}
+				return 0
+			},
+		}, 503, "Service Unavailable\n", true},
+		{"panic rendered by HandleErrors", func(w http.ResponseWriter, r *http.Request) { panic("boom") }, &ErrorParams{
+			Render: func(w http.ResponseWriter, r *http.Request, status int, err error) {
+				w.WriteHeader(status)
+				fmt.Fprintf(w, "error %d", status)
+			},
+		}, 500, "error 500", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buffer.Reset()
+			var reported *PanicError
+			handler := Middleware(Recover(RecoverParams{OnPanic: func(r *http.Request, err *PanicError) {
+				reported = err
+			}})).ApplyToFunc(tt.handler)
+			if tt.errors != nil {
+				handler = HandleErrors(*tt.errors)(handler)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+			if recorder.Code != tt.wantStatus || recorder.Body.String() != tt.wantBody {
+				t.Errorf("response = %d %q, want %d %q", recorder.Code, recorder.Body.String(), tt.wantStatus, tt.wantBody)
+			}
+			if (reported != nil) != tt.wantPanic {
+				t.Fatalf("OnPanic called = %v, want %v", reported != nil, tt.wantPanic)
+			}
+			if tt.wantPanic && !bytes.Contains(reported.Stack, []byte("recover_test.go")) {
+				t.Errorf("stack does not contain the panicking function:\n%s", reported.Stack)
+			}
+			if tt.wantPanic && !strings.Contains(buffer.String(), "Recovered from panic") {
+				t.Errorf("panic was not logged: %q", buffer.String())
+			}
+		})
+	}
+}
+
+func TestRecover_abort(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"ErrAbortHandler is passed on", func(w http.ResponseWriter, r *http.Request) { panic(http.ErrAbortHandler) }},
+		{"panic after response started", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "partial")
+			panic("boom")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recovered := recover(); recovered != http.ErrAbortHandler {
+					t.Errorf("recovered %v, want http.ErrAbortHandler", recovered)
+				}
+			}()
+			Middleware(Recover(RecoverParams{})).ApplyToFunc(tt.handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		})
+	}
+}
+
+func TestRecover_interfaces(t *testing.T) {
+	var flusher, hijacker bool
+	handler := Middleware(Recover(RecoverParams{})).ApplyToFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, flusher = w.(http.Flusher)
+		_, hijacker = w.(http.Hijacker)
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if !flusher || hijacker {
+		t.Errorf("behind Recover: Flusher %v, Hijacker %v, want true, false", flusher, hijacker)
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if !flusher || !hijacker {
+		t.Errorf("behind Recover on a server: Flusher %v, Hijacker %v, want true, true", flusher, hijacker)
+	}
+}
@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"time"
+)
+
+//RequestIDParams configures RequestID.
+//Header is the request and response header of the ID and defaults to X-Request-ID.
+//Incoming IDs that are longer than MaxLength (default 64) or contain other characters than letters, digits
+//and -_.:+/=@ are replaced by a new ID from Generate, which defaults to NewUUIDv7.
+type RequestIDParams struct {
+	Header    string
+	MaxLength int
+	Generate  func() string
+}
+
+//RequestIDFromContext returns the ID of the request set by RequestID
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+//requestIDSuffix returns the ID of the request in the form appended to log lines, or nothing if it has no ID
+func requestIDSuffix(r *http.Request) string {
+	if id := RequestIDFromContext(r.Context()); id != "" {
+		return " (request " + id + ")"
+	}
+	return ""
+}
+
+func validRequestID(id string, maxLength int) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':' || c == '+' || c == '/' || c == '=' || c == '@':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+type requestIDFilter struct {
+	next   http.Handler
+	params RequestIDParams
+}
+
+func (rf requestIDFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get(rf.params.Header)
+	if !validRequestID(id, rf.params.MaxLength) {
+		id = rf.params.Generate()
+		r = r.Clone(r.Context())
+		r.Header.Set(rf.params.Header, id)
+	}
+	w.Header().Set(rf.params.Header, id)
+	recordRequestID(r.Context(), id)
+	ctx := context.WithValue(r.Context(), requestIDKey, id)
+	rf.next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+//RequestID assigns an ID to every request, which is taken from the request header if the client or a proxy
+//already sent a valid one. The ID is returned in the response header, stored in the request context
+//and included in the logs of the filters and the access log. It should be the first middleware of a chain:
+//  mux.Handle("/", middleware.Assemble(middleware.RequestID(middleware.RequestIDParams{}), accessLog, hmac).ApplyToFunc(handler))
+//Use RequestIDTransport to pass the ID on to other services.
+func RequestID(params RequestIDParams) func(http.Handler) http.Handler {
+	if params.Header == "" {
+		params.Header = "X-Request-ID"
+	}
+	params.Header = textproto.CanonicalMIMEHeaderKey(params.Header)
+	if params.MaxLength <= 0 {
+		params.MaxLength = 64
+	}
+	if params.Generate == nil {
+		params.Generate = NewUUIDv7
+	}
+	fn := func(next http.Handler) http.Handler {
+		return requestIDFilter{next: next, params: params}
+	}
+	return fn
+}
+
+//RequestIDTransport is a http.RoundTripper that sets the ID of the request in the context of outgoing requests,
+//so that the request ID is propagated to other services:
+//  client := &http.Client{Transport: &middleware.RequestIDTransport{}}
+//  request, _ := http.NewRequestWithContext(r.Context(), "GET", "https://api.example.org/users", nil)
+//  response, err := client.Do(request)
+//Header defaults to X-Request-ID and Base to http.DefaultTransport. Requests that already have the header are not changed.
+type RequestIDTransport struct {
+	Header string
+	Base   http.RoundTripper
+}
+
+//RoundTrip implements the http.RoundTripper interface
+func (t *RequestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	header := t.Header
+	if header == "" {
+		header = "X-Request-ID"
+	}
+	id := RequestIDFromContext(req.Context())
+	if id == "" || req.Header.Get(header) != "" {
+		return base.RoundTrip(req)
+	}
+	// a RoundTripper must not modify the request
+	req = req.Clone(req.Context())
+	req.Header.Set(header, id)
+	return base.RoundTrip(req)
+}
+
+//NewUUIDv7 generates a UUID of version 7 as defined in RFC 9562, which starts with the current time
+//in milliseconds, so that IDs of later requests sort after those of earlier ones
+func NewUUIDv7() string {
+	var uuid [16]byte
+	if _, err := rand.Read(uuid[6:]); err != nil {
+		panic(fmt.Sprintf("Failed to generate UUID: %s", err))
+	}
+	return formatUUIDv7(uuid, time.Now())
+}
+
+func formatUUIDv7(uuid [16]byte, now time.Time) string {
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], uint64(now.UnixMilli()))
+	copy(uuid[:6], timestamp[2:])
+	uuid[6] = 0x70 | uuid[6]&0x0f
+	uuid[8] = 0x80 | uuid[8]&0x3f
+	encoded := hex.EncodeToString(uuid[:])
+	return encoded[:8] + "-" + encoded[8:12] + "-" + encoded[12:16] + "-" + encoded[16:20] + "-" + encoded[20:]
+}
+
+//NewULID generates a Universally Unique Lexicographically Sortable Identifier, 26 characters in Crockford's base32
+//that start with the current time in milliseconds
+func NewULID() string {
+	var ulid [16]byte
+	if _, err := rand.Read(ulid[6:]); err != nil {
+		panic(fmt.Sprintf("Failed to generate ULID: %s", err))
+	}
+	return formatULID(ulid, time.Now())
+}
+
+func formatULID(ulid [16]byte, now time.Time) string {
+	const alphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], uint64(now.UnixMilli()))
+	copy(ulid[:6], timestamp[2:])
+	// 128 bits are encoded in 26 characters of 5 bits, the first character holds only 3 bits
+	var encoded [26]byte
+	hi, lo := binary.BigEndian.Uint64(ulid[:8]), binary.BigEndian.Uint64(ulid[8:])
+	for i := 25; i >= 0; i-- {
+		encoded[i] = alphabet[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(encoded[:])
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestID(t *testing.T) {
+	uuidv7 := `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`
+	tests := []struct {
+		name     string
+		params   RequestIDParams
+		header   http.Header
+		wantID   string
+		wantName string
+	}{
+		{"generated", RequestIDParams{}, http.Header{}, uuidv7, "X-Request-Id"},
+		{"incoming", RequestIDParams{}, http.Header{"X-Request-Id": {"web-1:4f2a_9=="}}, `^web-1:4f2a_9==$`, "X-Request-Id"},
+		{"too long", RequestIDParams{MaxLength: 8}, http.Header{"X-Request-Id": {"123456789"}}, uuidv7, "X-Request-Id"},
+		{"invalid characters", RequestIDParams{}, http.Header{"X-Request-Id": {"abc\n<script>"}}, uuidv7, "X-Request-Id"},
+		{"custom header and generator", RequestIDParams{Header: "x-correlation-id", Generate: NewULID}, http.Header{"X-Request-Id": {"ignored"}},
+			`^[0-9A-HJKMNP-TV-Z]{26}$`, "X-Correlation-Id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var contextID, headerID string
+			handler := Middleware(RequestID(tt.params)).ApplyToFunc(func(w http.ResponseWriter, r *http.Request) {
+				contextID = RequestIDFromContext(r.Context())
+				headerID = r.Header.Get(tt.wantName)
+			})
+			request := httptest.NewRequest("GET", "/", nil)
+			request.Header = tt.header
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			responseID := recorder.Header().Get(tt.wantName)
+			if !regexp.MustCompile(tt.wantID).MatchString(contextID) {
+				t.Errorf("RequestIDFromContext() = %q, want match of %s", contextID, tt.wantID)
+			}
+			if responseID != contextID || headerID != contextID {
+				t.Errorf("response header %q and request header %q differ from ID %q", responseID, headerID, contextID)
+			}
+		})
+	}
+}
+
+func TestRequestID_formats(t *testing.T) {
+	ulid := formatULID([16]byte{}, time.UnixMilli(1469918176385))
+	if ulid != "01ARYZ6S410000000000000000" {
+		t.Errorf("formatULID() = %s, want 01ARYZ6S410000000000000000", ulid)
+	}
+	uuid := formatUUIDv7([16]byte{6: 0xcc, 7: 0xc3, 8: 0x18, 9: 0xc4, 10: 0xdc, 11: 0x0c, 12: 0x0c, 13: 0x07, 14: 0x39, 15: 0x8f},
+		time.UnixMilli(0x017f22e279b0))
+	if uuid != "017f22e2-79b0-7cc3-98c4-dc0c0c07398f" {
+		t.Errorf("formatUUIDv7() = %s, want 017f22e2-79b0-7cc3-98c4-dc0c0c07398f", uuid)
+	}
+	if first, second := NewULID(), NewULID(); first == second {
+		t.Errorf("NewULID() returned %s twice", first)
+	}
+}
+
+func TestRequestIDTransport(t *testing.T) {
+	var received []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get("X-Request-ID"))
+	}))
+	defer upstream.Close()
+	client := &http.Client{Transport: &RequestIDTransport{}}
+
+	handler := Middleware(RequestID(RequestIDParams{})).ApplyToFunc(func(w http.ResponseWriter, r *http.Request) {
+		propagated, _ := http.NewRequestWithContext(r.Context(), "GET", upstream.URL, nil)
+		explicit, _ := http.NewRequestWithContext(r.Context(), "GET", upstream.URL, nil)
+		explicit.Header.Set("X-Request-ID", "explicit")
+		for _, request := range []*http.Request{propagated, explicit} {
+			response, err := client.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+		}
+		if propagated.Header.Get("X-Request-ID") != "" {
+			t.Errorf("RoundTrip() modified the request")
+		}
+	})
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set("X-Request-ID", "incoming")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	withoutID, _ := http.NewRequest("GET", upstream.URL, nil)
+	response, err := client.Do(withoutID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if strings.Join(received, ",") != "incoming,explicit," {
+		t.Errorf("upstream received IDs %q, want incoming, explicit and none", received)
+	}
+}
+
+func TestRequestID_denyLog(t *testing.T) {
+	var buffer bytes.Buffer
+	log.SetOutput(&buffer)
+	defer log.SetOutput(os.Stderr)
+
+	handler := Assemble(RequestID(RequestIDParams{}), IPFilter([]string{"10.0.0.0/8"}, "")).ApplyToFunc(func(w http.ResponseWriter, r *http.Request) {})
+	request := httptest.NewRequest("GET", "/admin", nil)
+	request.Header.Set("X-Request-ID", "req-42")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	if !strings.Contains(buffer.String(), "(request req-42)") {
+		t.Errorf("deny log %q does not contain the request ID", buffer.String())
+	}
+}
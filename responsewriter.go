@@ -0,0 +1,219 @@
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+//ResponseWriter is a http.ResponseWriter that records the status code and the number of bytes of the response,
+//for middlewares that observe responses like access logs or metrics. Status is 0 until the header is written.
+//Unwrap returns the underlying http.ResponseWriter, which is used by http.ResponseController.
+type ResponseWriter interface {
+	http.ResponseWriter
+	Status() int
+	BytesWritten() int64
+	Unwrap() http.ResponseWriter
+}
+
+//WrapResponseWriter returns a ResponseWriter for w, which implements http.Flusher, http.Hijacker, io.ReaderFrom
+//and http.Pusher exactly if w implements them, so that the following handlers can use them as usual:
+//  func (l logger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+//  	recorder := middleware.WrapResponseWriter(w)
+//  	l.next.ServeHTTP(recorder, r)
+//  	log.Printf("%s %s %d %d", r.Method, r.URL, recorder.Status(), recorder.BytesWritten())
+//  }
+//If w already is a ResponseWriter returned by WrapResponseWriter, it is returned unchanged.
+func WrapResponseWriter(w http.ResponseWriter) ResponseWriter {
+	if _, ok := w.(interface{ recorder() *responseWriter }); ok {
+		return w.(ResponseWriter)
+	}
+	rw := &responseWriter{ResponseWriter: w}
+	const (
+		flusher = 1 << iota
+		hijacker
+		readerFrom
+		pusher
+	)
+	features := 0
+	if _, ok := w.(http.Flusher); ok {
+		features |= flusher
+	}
+	if _, ok := w.(http.Hijacker); ok {
+		features |= hijacker
+	}
+	if _, ok := w.(io.ReaderFrom); ok {
+		features |= readerFrom
+	}
+	if _, ok := w.(http.Pusher); ok {
+		features |= pusher
+	}
+	f, h, rf, p := (*flushWriter)(rw), (*hijackWriter)(rw), (*readerFromWriter)(rw), (*pushWriter)(rw)
+	switch features {
+	case flusher:
+		return struct {
+			*responseWriter
+			http.Flusher
+		}{rw, f}
+	case hijacker:
+		return struct {
+			*responseWriter
+			http.Hijacker
+		}{rw, h}
+	case flusher | hijacker:
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Hijacker
+		}{rw, f, h}
+	case readerFrom:
+		return struct {
+			*responseWriter
+			io.ReaderFrom
+		}{rw, rf}
+	case flusher | readerFrom:
+		return struct {
+			*responseWriter
+			http.Flusher
+			io.ReaderFrom
+		}{rw, f, rf}
+	case hijacker | readerFrom:
+		return struct {
+			*responseWriter
+			http.Hijacker
+			io.ReaderFrom
+		}{rw, h, rf}
+	case flusher | hijacker | readerFrom:
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+		}{rw, f, h, rf}
+	case pusher:
+		return struct {
+			*responseWriter
+			http.Pusher
+		}{rw, p}
+	case flusher | pusher:
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Pusher
+		}{rw, f, p}
+	case hijacker | pusher:
+		return struct {
+			*responseWriter
+			http.Hijacker
+			http.Pusher
+		}{rw, h, p}
+	case flusher | hijacker | pusher:
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{rw, f, h, p}
+	case readerFrom | pusher:
+		return struct {
+			*responseWriter
+			io.ReaderFrom
+			http.Pusher
+		}{rw, rf, p}
+	case flusher | readerFrom | pusher:
+		return struct {
+			*responseWriter
+			http.Flusher
+			io.ReaderFrom
+			http.Pusher
+		}{rw, f, rf, p}
+	case hijacker | readerFrom | pusher:
+		return struct {
+			*responseWriter
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+		}{rw, h, rf, p}
+	case flusher | hijacker | readerFrom | pusher:
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+		}{rw, f, h, rf, p}
+	}
+	return rw
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	// informational responses except 101 Switching Protocols are followed by the actual status
+	if rw.status == 0 && (status >= 200 || status == 101) {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = 200
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+func (rw *responseWriter) Status() int {
+	return rw.status
+}
+
+func (rw *responseWriter) BytesWritten() int64 {
+	return rw.bytes
+}
+
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+func (rw *responseWriter) recorder() *responseWriter {
+	return rw
+}
+
+type flushWriter responseWriter
+
+func (f *flushWriter) Flush() {
+	if f.status == 0 {
+		f.status = 200
+	}
+	f.ResponseWriter.(http.Flusher).Flush()
+}
+
+type hijackWriter responseWriter
+
+func (h *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return h.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+type readerFromWriter responseWriter
+
+func (rf *readerFromWriter) ReadFrom(src io.Reader) (int64, error) {
+	if rf.status == 0 {
+		rf.status = 200
+	}
+	n, err := rf.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+	rf.bytes += n
+	return n, err
+}
+
+type pushWriter responseWriter
+
+func (p *pushWriter) Push(target string, opts *http.PushOptions) error {
+	return p.ResponseWriter.(http.Pusher).Push(target, opts)
+}
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+//fullWriter implements all optional interfaces of a http.ResponseWriter
+type fullWriter struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+	pushed   string
+}
+
+func (fw *fullWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	fw.hijacked = true
+	return nil, nil, nil
+}
+
+func (fw *fullWriter) ReadFrom(src io.Reader) (int64, error) {
+	return io.Copy(fw.ResponseRecorder, src)
+}
+
+func (fw *fullWriter) Push(target string, opts *http.PushOptions) error {
+	fw.pushed = target
+	return nil
+}
+
+func TestWrapResponseWriter_interfaces(t *testing.T) {
+	full := &fullWriter{ResponseRecorder: httptest.NewRecorder()}
+	tests := []struct {
+		name                                  string
+		writer                                http.ResponseWriter
+		flusher, hijacker, readerFrom, pusher bool
+	}{
+		{"plain", struct{ http.ResponseWriter }{full}, false, false, false, false},
+		{"flusher", httptest.NewRecorder(), true, false, false, false},
+		{"all", full, true, true, true, true},
+		{"http/1.1", struct {
+			http.ResponseWriter
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+		}{full, full, full, full}, true, true, true, false},
+		{"http/2", struct {
+			http.ResponseWriter
+			http.Flusher
+			http.Pusher
+		}{full, full, full}, true, false, false, true},
+		{"hijacker and pusher", struct {
+			http.ResponseWriter
+			http.Hijacker
+			http.Pusher
+		}{full, full, full}, false, true, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := WrapResponseWriter(tt.writer)
+			_, flusher := w.(http.Flusher)
+			_, hijacker := w.(http.Hijacker)
+			_, readerFrom := w.(io.ReaderFrom)
+			_, pusher := w.(http.Pusher)
+			if flusher != tt.flusher || hijacker != tt.hijacker || readerFrom != tt.readerFrom || pusher != tt.pusher {
+				t.Errorf("Flusher %v, Hijacker %v, ReaderFrom %v, Pusher %v, want %v, %v, %v, %v",
+					flusher, hijacker, readerFrom, pusher, tt.flusher, tt.hijacker, tt.readerFrom, tt.pusher)
+			}
+			if w.Unwrap() != tt.writer {
+				t.Errorf("Unwrap() does not return the wrapped writer")
+			}
+			if WrapResponseWriter(w) != w {
+				t.Errorf("WrapResponseWriter() wraps its own writer again")
+			}
+		})
+	}
+}
+
+func TestWrapResponseWriter_recording(t *testing.T) {
+	tests := []struct {
+		name      string
+		handler   func(w http.ResponseWriter)
+		wantCode  int
+		wantBytes int64
+	}{
+		{"nothing written", func(w http.ResponseWriter) {}, 0, 0},
+		{"implicit status", func(w http.ResponseWriter) { io.WriteString(w, "hello") }, 200, 5},
+		{"explicit status", func(w http.ResponseWriter) {
+			w.WriteHeader(404)
+			w.WriteHeader(500)
+			io.WriteString(w, "not found")
+		}, 404, 9},
+		{"informational status", func(w http.ResponseWriter) {
+			w.WriteHeader(103)
+			w.WriteHeader(201)
+		}, 201, 0},
+		{"switching protocols", func(w http.ResponseWriter) { w.WriteHeader(101) }, 101, 0},
+		{"flush", func(w http.ResponseWriter) { w.(http.Flusher).Flush() }, 200, 0},
+		{"read from", func(w http.ResponseWriter) { w.(io.ReaderFrom).ReadFrom(strings.NewReader("streamed")) }, 200, 8},
+		{"hijack and push", func(w http.ResponseWriter) {
+			w.(http.Hijacker).Hijack()
+			w.(http.Pusher).Push("/app.js", nil)
+		}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			full := &fullWriter{ResponseRecorder: httptest.NewRecorder()}
+			w := WrapResponseWriter(full)
+			tt.handler(w)
+			if w.Status() != tt.wantCode || w.BytesWritten() != tt.wantBytes {
+				t.Errorf("Status() = %d, BytesWritten() = %d, want %d, %d", w.Status(), w.BytesWritten(), tt.wantCode, tt.wantBytes)
+			}
+			if int64(full.Body.Len()) != tt.wantBytes {
+				t.Errorf("underlying writer received %d bytes, want %d", full.Body.Len(), tt.wantBytes)
+			}
+		})
+	}
+}
+
+func TestWrapResponseWriter_responseController(t *testing.T) {
+	var status int
+	var deadlineErr error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := WrapResponseWriter(w)
+		controller := http.NewResponseController(recorder)
+		deadlineErr = controller.SetWriteDeadline(time.Now().Add(time.Minute))
+		recorder.WriteHeader(202)
+		controller.Flush()
+		status = recorder.Status()
+	}))
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if deadlineErr != nil {
+		t.Errorf("SetWriteDeadline() through Unwrap failed: %v", deadlineErr)
+	}
+	if resp.StatusCode != 202 || status != 202 {
+		t.Errorf("status = %d, recorded %d, want 202", resp.StatusCode, status)
+	}
+}
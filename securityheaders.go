@@ -0,0 +1,284 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//SecurityHeadersParams configures SecurityHeaders. Only headers with a non-empty value are set, so that
+//DefaultSecurityHeaders can be adjusted by clearing or replacing single fields.
+//HSTSMaxAge enables Strict-Transport-Security, optionally for all subdomains and with preloading.
+//CSP is sent as Content-Security-Policy, ReportOnlyCSP as Content-Security-Policy-Report-Only; both may be set
+//to try out a new policy while the current one is still enforced.
+type SecurityHeadersParams struct {
+	HSTSMaxAge                time.Duration
+	HSTSIncludeSubdomains     bool
+	HSTSPreload               bool
+	ContentTypeOptions        string
+	ReferrerPolicy            string
+	PermissionsPolicy         string
+	CrossOriginOpenerPolicy   string
+	CrossOriginEmbedderPolicy string
+	CrossOriginResourcePolicy string
+	CSP                       *CSP
+	ReportOnlyCSP             *CSP
+}
+
+//DefaultSecurityHeaders returns headers that are appropriate for most applications served over HTTPS:
+//  Strict-Transport-Security: max-age=63072000; includeSubDomains
+//  X-Content-Type-Options: nosniff
+//  Referrer-Policy: strict-origin-when-cross-origin
+//  Cross-Origin-Opener-Policy: same-origin
+//  Cross-Origin-Resource-Policy: same-origin
+//  Content-Security-Policy: default-src 'self'; object-src 'none'; base-uri 'self'; frame-ancestors 'none'
+func DefaultSecurityHeaders() SecurityHeadersParams {
+	csp := NewCSP().DefaultSrc(CSPSelf).ObjectSrc(CSPNone).BaseURI(CSPSelf).FrameAncestors(CSPNone)
+	return SecurityHeadersParams{
+		HSTSMaxAge:                2 * 365 * 24 * time.Hour,
+		HSTSIncludeSubdomains:     true,
+		ContentTypeOptions:        "nosniff",
+		ReferrerPolicy:            "strict-origin-when-cross-origin",
+		CrossOriginOpenerPolicy:   "same-origin",
+		CrossOriginResourcePolicy: "same-origin",
+		CSP:                       &csp,
+	}
+}
+
+//Sources of a Content-Security-Policy. CSPNonce is replaced with a random nonce for every request.
+const (
+	CSPSelf           = "'self'"
+	CSPNone           = "'none'"
+	CSPUnsafeInline   = "'unsafe-inline'"
+	CSPUnsafeEval     = "'unsafe-eval'"
+	CSPStrictDynamic  = "'strict-dynamic'"
+	CSPReportSample   = "'report-sample'"
+	CSPWasmUnsafeEval = "'wasm-unsafe-eval'"
+	CSPNonce          = "'nonce-{nonce}'"
+)
+
+//CSP is a Content-Security-Policy. Each method returns a copy of the policy with the directive added:
+//  csp := middleware.NewCSP().
+//  	DefaultSrc(middleware.CSPSelf).
+//  	ScriptSrc(middleware.CSPNonce, middleware.CSPStrictDynamic).
+//  	ImgSrc(middleware.CSPSelf, "data:", "https://images.example.org").
+//  	ReportTo("csp-endpoint")
+type CSP struct {
+	directives []string
+}
+
+//NewCSP creates an empty policy
+func NewCSP() CSP {
+	return CSP{}
+}
+
+//Directive adds a directive with the sources, e.g. Directive("script-src-elem", CSPSelf)
+func (c CSP) Directive(name string, sources ...string) CSP {
+	directive := strings.Join(append([]string{name}, sources...), " ")
+	c.directives = append(c.directives[:len(c.directives):len(c.directives)], directive)
+	return c
+}
+
+//DefaultSrc adds the default-src directive
+func (c CSP) DefaultSrc(sources ...string) CSP {
+	return c.Directive("default-src", sources...)
+}
+
+//ScriptSrc adds the script-src directive
+func (c CSP) ScriptSrc(sources ...string) CSP {
+	return c.Directive("script-src", sources...)
+}
+
+//StyleSrc adds the style-src directive
+func (c CSP) StyleSrc(sources ...string) CSP {
+	return c.Directive("style-src", sources...)
+}
+
+//ImgSrc adds the img-src directive
+func (c CSP) ImgSrc(sources ...string) CSP {
+	return c.Directive("img-src", sources...)
+}
+
+//FontSrc adds the font-src directive
+func (c CSP) FontSrc(sources ...string) CSP {
+	return c.Directive("font-src", sources...)
+}
+
+//ConnectSrc adds the connect-src directive
+func (c CSP) ConnectSrc(sources ...string) CSP {
+	return c.Directive("connect-src", sources...)
+}
+
+//MediaSrc adds the media-src directive
+func (c CSP) MediaSrc(sources ...string) CSP {
+	return c.Directive("media-src", sources...)
+}
+
+//ObjectSrc adds the object-src directive
+func (c CSP) ObjectSrc(sources ...string) CSP {
+	return c.Directive("object-src", sources...)
+}
+
+//FrameSrc adds the frame-src directive
+func (c CSP) FrameSrc(sources ...string) CSP {
+	return c.Directive("frame-src", sources...)
+}
+
+//WorkerSrc adds the worker-src directive
+func (c CSP) WorkerSrc(sources ...string) CSP {
+	return c.Directive("worker-src", sources...)
+}
+
+//ManifestSrc adds the manifest-src directive
+func (c CSP) ManifestSrc(sources ...string) CSP {
+	return c.Directive("manifest-src", sources...)
+}
+
+//BaseURI adds the base-uri directive
+func (c CSP) BaseURI(sources ...string) CSP {
+	return c.Directive("base-uri", sources...)
+}
+
+//FormAction adds the form-action directive
+func (c CSP) FormAction(sources ...string) CSP {
+	return c.Directive("form-action", sources...)
+}
+
+//FrameAncestors adds the frame-ancestors directive
+func (c CSP) FrameAncestors(sources ...string) CSP {
+	return c.Directive("frame-ancestors", sources...)
+}
+
+//UpgradeInsecureRequests adds the upgrade-insecure-requests directive
+func (c CSP) UpgradeInsecureRequests() CSP {
+	return c.Directive("upgrade-insecure-requests")
+}
+
+//ReportURI adds the report-uri directive
+func (c CSP) ReportURI(uri string) CSP {
+	return c.Directive("report-uri", uri)
+}
+
+//ReportTo adds the report-to directive with the name of a reporting endpoint
+func (c CSP) ReportTo(endpoint string) CSP {
+	return c.Directive("report-to", endpoint)
+}
+
+//String returns the policy as sent in the header, with CSPNonce not yet replaced
+func (c CSP) String() string {
+	return strings.Join(c.directives, "; ")
+}
+
+func (c CSP) validate() error {
+	for _, directive := range c.directives {
+		if strings.ContainsAny(directive, ";,\r\n") {
+			return fmt.Errorf("invalid directive %q", directive)
+		}
+	}
+	return nil
+}
+
+//CSPNonceFromContext returns the nonce generated for the request by SecurityHeaders, to be used in the nonce
+//attribute of inline scripts and styles:
+//  nonce := middleware.CSPNonceFromContext(r.Context())
+//  fmt.Fprintf(w, `<script nonce="%s">...</script>`, nonce)
+func CSPNonceFromContext(ctx context.Context) string {
+	nonce, _ := ctx.Value(cspNonceKey).(string)
+	return nonce
+}
+
+type securityHeaders struct {
+	next         http.Handler
+	headers      http.Header
+	csp          string
+	reportOnly   string
+	nonceEnabled bool
+}
+
+func (sh securityHeaders) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	header := w.Header()
+	for name, values := range sh.headers {
+		header[name] = append([]string(nil), values...)
+	}
+	if !sh.nonceEnabled {
+		sh.next.ServeHTTP(w, r)
+		return
+	}
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		panic(fmt.Sprintf("Failed to generate CSP nonce: %s", err))
+	}
+	encoded := base64.StdEncoding.EncodeToString(nonce[:])
+	if sh.csp != "" {
+		header.Set("Content-Security-Policy", strings.ReplaceAll(sh.csp, CSPNonce, "'nonce-"+encoded+"'"))
+	}
+	if sh.reportOnly != "" {
+		header.Set("Content-Security-Policy-Report-Only", strings.ReplaceAll(sh.reportOnly, CSPNonce, "'nonce-"+encoded+"'"))
+	}
+	ctx := context.WithValue(r.Context(), cspNonceKey, encoded)
+	sh.next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+//SecurityHeaders sets security related response headers before the following handlers are called, which may
+//still change them:
+//  params := middleware.DefaultSecurityHeaders()
+//  csp := params.CSP.ScriptSrc(middleware.CSPNonce)
+//  params.CSP = &csp
+//  params.PermissionsPolicy = "camera=(), microphone=(), geolocation=()"
+//  secure := middleware.SecurityHeaders(params)
+//It panics if one of the policies contains an invalid directive.
+func SecurityHeaders(params SecurityHeadersParams) func(http.Handler) http.Handler {
+	sh := securityHeaders{headers: make(http.Header)}
+	set := func(name string, value string) {
+		if value != "" {
+			sh.headers.Set(name, value)
+		}
+	}
+	if params.HSTSMaxAge > 0 {
+		hsts := "max-age=" + strconv.FormatInt(int64(params.HSTSMaxAge.Seconds()), 10)
+		if params.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if params.HSTSPreload {
+			hsts += "; preload"
+		}
+		set("Strict-Transport-Security", hsts)
+	}
+	set("X-Content-Type-Options", params.ContentTypeOptions)
+	set("Referrer-Policy", params.ReferrerPolicy)
+	set("Permissions-Policy", params.PermissionsPolicy)
+	set("Cross-Origin-Opener-Policy", params.CrossOriginOpenerPolicy)
+	set("Cross-Origin-Embedder-Policy", params.CrossOriginEmbedderPolicy)
+	set("Cross-Origin-Resource-Policy", params.CrossOriginResourcePolicy)
+	for _, policy := range []struct {
+		csp    *CSP
+		header string
+		nonce  *string
+	}{{params.CSP, "Content-Security-Policy", &sh.csp}, {params.ReportOnlyCSP, "Content-Security-Policy-Report-Only", &sh.reportOnly}} {
+		if policy.csp == nil || len(policy.csp.directives) == 0 {
+			continue
+		}
+		if err := policy.csp.validate(); err != nil {
+			panic(fmt.Sprintf("Failed to create %s: %s", policy.header, err))
+		}
+		value := policy.csp.String()
+		if strings.Contains(value, CSPNonce) {
+			// the header is set per request with a new nonce
+			*policy.nonce = value
+			sh.nonceEnabled = true
+		} else {
+			set(policy.header, value)
+		}
+	}
+	fn := func(next http.Handler) http.Handler {
+		sh := sh
+		sh.next = next
+		return sh
+	}
+	return fn
+}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSP(t *testing.T) {
+	base := NewCSP().DefaultSrc(CSPSelf)
+	withScripts := base.ScriptSrc(CSPSelf, CSPNonce, CSPStrictDynamic)
+	withImages := base.ImgSrc(CSPSelf, "data:").UpgradeInsecureRequests().ReportTo("csp")
+	tests := []struct {
+		name string
+		csp  CSP
+		want string
+	}{
+		{"base", base, "default-src 'self'"},
+		{"scripts", withScripts, "default-src 'self'; script-src 'self' 'nonce-{nonce}' 'strict-dynamic'"},
+		{"copies do not share directives", withImages, "default-src 'self'; img-src 'self' data:; upgrade-insecure-requests; report-to csp"},
+		{"generic directive", NewCSP().Directive("sandbox", "allow-scripts"), "sandbox allow-scripts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.csp.String(); got != tt.want {
+				t.Errorf("CSP.String() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	defaults := DefaultSecurityHeaders()
+	custom := DefaultSecurityHeaders()
+	custom.HSTSMaxAge = time.Hour
+	custom.HSTSPreload = true
+	custom.CrossOriginOpenerPolicy = ""
+	custom.CrossOriginEmbedderPolicy = "require-corp"
+	custom.PermissionsPolicy = "camera=(), microphone=()"
+	custom.CSP = nil
+	reportOnly := NewCSP().DefaultSrc(CSPNone)
+	custom.ReportOnlyCSP = &reportOnly
+
+	tests := []struct {
+		name   string
+		params SecurityHeadersParams
+		want   map[string]string
+	}{
+		{"defaults", defaults, map[string]string{
+			"Strict-Transport-Security":    "max-age=63072000; includeSubDomains",
+			"X-Content-Type-Options":       "nosniff",
+			"Referrer-Policy":              "strict-origin-when-cross-origin",
+			"Cross-Origin-Opener-Policy":   "same-origin",
+			"Cross-Origin-Resource-Policy": "same-origin",
+			"Cross-Origin-Embedder-Policy": "",
+			"Permissions-Policy":           "",
+			"Content-Security-Policy":      "default-src 'self'; object-src 'none'; base-uri 'self'; frame-ancestors 'none'",
+		}},
+		{"custom", custom, map[string]string{
+			"Strict-Transport-Security":           "max-age=3600; includeSubDomains; preload",
+			"Cross-Origin-Opener-Policy":          "",
+			"Cross-Origin-Embedder-Policy":        "require-corp",
+			"Permissions-Policy":                  "camera=(), microphone=()",
+			"Content-Security-Policy":             "",
+			"Content-Security-Policy-Report-Only": "default-src 'none'",
+		}},
+		{"empty", SecurityHeadersParams{}, map[string]string{"Strict-Transport-Security": "", "X-Content-Type-Options": ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := SecurityHeaders(tt.params)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+			for name, want := range tt.want {
+				if got := recorder.Header().Get(name); got != want {
+					t.Errorf("SecurityHeaders() header %s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSecurityHeaders_nonce(t *testing.T) {
+	csp := NewCSP().DefaultSrc(CSPSelf).ScriptSrc(CSPNonce)
+	reportOnly := csp.StyleSrc(CSPNonce)
+	handler := SecurityHeaders(SecurityHeadersParams{CSP: &csp, ReportOnlyCSP: &reportOnly})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(CSPNonceFromContext(r.Context())))
+	}))
+
+	nonces := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+		nonce := recorder.Body.String()
+		if len(nonce) != 24 || nonces[nonce] {
+			t.Fatalf("CSPNonceFromContext() = %q, expected a new nonce", nonce)
+		}
+		nonces[nonce] = true
+		if got := recorder.Header().Get("Content-Security-Policy"); got != "default-src 'self'; script-src 'nonce-"+nonce+"'" {
+			t.Errorf("Content-Security-Policy = %s", got)
+		}
+		if got := recorder.Header().Get("Content-Security-Policy-Report-Only"); strings.Count(got, "'nonce-"+nonce+"'") != 2 {
+			t.Errorf("Content-Security-Policy-Report-Only = %s", got)
+		}
+	}
+}
+
+func TestSecurityHeaders_invalidCSP(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("SecurityHeaders() with invalid CSP should panic")
+		}
+	}()
+	csp := NewCSP().ScriptSrc("'self'; script-src *")
+	SecurityHeaders(SecurityHeadersParams{CSP: &csp})
+}
@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+//cryptAlphabet is the base64 alphabet used by crypt(3)
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+const (
+	shaCryptDefaultRounds = 5000
+	shaCryptMinRounds     = 1000
+	shaCryptMaxRounds     = 999999999
+	shaCryptMaxSaltLength = 16
+)
+
+//shaCryptVariant describes SHA-256-crypt ($5$) or SHA-512-crypt ($6$).
+//order is the permutation of the digest bytes before they are encoded, in groups of three bytes.
+type shaCryptVariant struct {
+	prefix string
+	hash   func() hash.Hash
+	order  []int
+}
+
+var sha256Crypt = shaCryptVariant{"$5$", sha256.New, []int{
+	0, 10, 20, 21, 1, 11, 12, 22, 2, 3, 13, 23, 24, 4, 14, 15, 25, 5, 6, 16, 26, 27, 7, 17, 18, 28, 8, 9, 19, 29, 31, 30,
+}}
+
+var sha512Crypt = shaCryptVariant{"$6$", sha512.New, []int{
+	0, 21, 42, 22, 43, 1, 44, 2, 23, 3, 24, 45, 25, 46, 4, 47, 5, 26, 6, 27, 48, 28, 49, 7, 50, 8, 29, 9, 30, 51,
+	31, 52, 10, 53, 11, 32, 12, 33, 54, 34, 55, 13, 56, 14, 35, 15, 36, 57, 37, 58, 16, 59, 17, 38, 18, 39, 60,
+	40, 61, 19, 62, 20, 41, 63,
+}}
+
+//shaCrypt computes the SHA-crypt digest of password as specified by Ulrich Drepper,
+//encoded in the base64 alphabet of crypt(3)
+func (v shaCryptVariant) shaCrypt(password []byte, salt []byte, rounds int) string {
+	sum := func(parts ...[]byte) []byte {
+		h := v.hash()
+		for _, part := range parts {
+			h.Write(part)
+		}
+		return h.Sum(nil)
+	}
+	// repeat returns length bytes of digest repeated
+	repeat := func(digest []byte, length int) []byte {
+		out := make([]byte, 0, length)
+		for len(out)+len(digest) <= length {
+			out = append(out, digest...)
+		}
+		return append(out, digest[:length-len(out)]...)
+	}
+
+	b := sum(password, salt, password)
+	a := v.hash()
+	a.Write(password)
+	a.Write(salt)
+	a.Write(repeat(b, len(password)))
+	for length := len(password); length > 0; length >>= 1 {
+		if length&1 == 1 {
+			a.Write(b)
+		} else {
+			a.Write(password)
+		}
+	}
+	digest := a.Sum(nil)
+
+	dp := v.hash()
+	for range password {
+		dp.Write(password)
+	}
+	p := repeat(dp.Sum(nil), len(password))
+	ds := v.hash()
+	for i := 0; i < 16+int(digest[0]); i++ {
+		ds.Write(salt)
+	}
+	s := repeat(ds.Sum(nil), len(salt))
+
+	for i := 0; i < rounds; i++ {
+		c := v.hash()
+		if i%2 == 1 {
+			c.Write(p)
+		} else {
+			c.Write(digest)
+		}
+		if i%3 != 0 {
+			c.Write(s)
+		}
+		if i%7 != 0 {
+			c.Write(p)
+		}
+		if i%2 == 1 {
+			c.Write(digest)
+		} else {
+			c.Write(p)
+		}
+		digest = c.Sum(nil)
+	}
+
+	var encoded strings.Builder
+	for i := 0; i < len(v.order); i += 3 {
+		var word uint32
+		n := 4
+		if len(v.order)-i < 3 {
+			// the remaining one or two bytes are encoded as if preceded by zeros
+			n = len(v.order) - i + 1
+		}
+		for _, index := range v.order[i:min(i+3, len(v.order))] {
+			word = word<<8 | uint32(digest[index])
+		}
+		for j := 0; j < n; j++ {
+			encoded.WriteByte(cryptAlphabet[word&0x3f])
+			word >>= 6
+		}
+	}
+	return encoded.String()
+}
+
+//newSHACryptVerifier returns a function that reports whether a password matches the SHA-256-crypt or
+//SHA-512-crypt hash, e.g. "$6$rounds=10000$<salt>$<hash>"
+func newSHACryptVerifier(hash string) (func(password string) bool, error) {
+	var variant shaCryptVariant
+	switch {
+	case strings.HasPrefix(hash, sha256Crypt.prefix):
+		variant = sha256Crypt
+	case strings.HasPrefix(hash, sha512Crypt.prefix):
+		variant = sha512Crypt
+	default:
+		return nil, fmt.Errorf("invalid SHA-crypt hash")
+	}
+	parts := strings.Split(hash[len(variant.prefix):], "$")
+	rounds := shaCryptDefaultRounds
+	if strings.HasPrefix(parts[0], "rounds=") {
+		var err error
+		rounds, err = strconv.Atoi(strings.TrimPrefix(parts[0], "rounds="))
+		if err != nil {
+			return nil, fmt.Errorf("invalid SHA-crypt rounds %s", parts[0])
+		}
+		rounds = max(shaCryptMinRounds, min(rounds, shaCryptMaxRounds))
+		parts = parts[1:]
+	}
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid SHA-crypt hash")
+	}
+	salt := []byte(parts[0])
+	if len(salt) > shaCryptMaxSaltLength {
+		salt = salt[:shaCryptMaxSaltLength]
+	}
+	expected := []byte(parts[1])
+	return func(password string) bool {
+		computed := []byte(variant.shaCrypt([]byte(password), salt, rounds))
+		return subtle.ConstantTimeCompare(computed, expected) == 1
+	}, nil
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import "testing"
+
+func Test_newSHACryptVerifier(t *testing.T) {
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		want     bool
+		wantErr  bool
+	}{
+		{"SHA-256", "$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5", "Hello world!", true, false},
+		{"SHA-256 wrong password", "$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5", "Hello world", false, false},
+		{"SHA-256 rounds", "$5$rounds=10000$saltstringsaltst$3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA", "Hello world!", true, false},
+		{"SHA-256 empty password", "$5$rounds=1000$x$kIBhdUvT3pHpfTjzR8s1XJu3y/HRJeFxMSffBtF8jx9", "", true, false},
+		{"SHA-512", "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1", "Hello world!", true, false},
+		{"SHA-512 rounds", "$6$rounds=1400$anotherlongsalts$POfYwTEok97VWcjxIiSOjiykti.o/pQs.wPvMxQ6Fm7I6IoYN3CmLs66x9t0oSwbtEW7o7UmJEiDwGqd8p4ur1",
+			"a very much longer text to encrypt.  This one even stretches over morethan one line.", true, false},
+		{"SHA-512 salt longer than 16 characters", "$6$rounds=10000$saltstringsaltstring$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.",
+			"Hello world!", true, false},
+		{"invalid rounds", "$6$rounds=many$salt$hash", "", false, true},
+		{"missing hash", "$6$salt", "", false, true},
+		{"unsupported algorithm", "$1$salt$hash", "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verify, err := newSHACryptVerifier(tt.hash)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newSHACryptVerifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && verify(tt.password) != tt.want {
+				t.Errorf("verify(%q) = %v, want %v", tt.password, !tt.want, tt.want)
+			}
+		})
+	}
+}